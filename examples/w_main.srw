@@ -0,0 +1,49 @@
+$PBExportHeader$w_main.srw
+$PBExportComments$Main window
+forward
+global type w_main from window
+end type
+type cb_ok from commandbutton within w_main
+end type
+end forward
+
+global type w_main from window
+integer width = 2000
+integer height = 1200
+boolean titlebar = true
+string title = "Main"
+windowtype windowtype = main!
+cb_ok cb_ok
+end type
+global w_main w_main
+
+type variables
+long il_count
+end variables
+
+forward prototypes
+public function integer of_count (string as_name)
+end prototypes
+
+public function integer of_count (string as_name);il_count = il_count + 1
+return il_count
+end function
+
+on w_main.create
+this.cb_ok = create cb_ok
+end on
+
+on w_main.destroy
+destroy(this.cb_ok)
+end on
+
+event open;of_count(this.title)
+end event
+
+type cb_ok from commandbutton within w_main
+integer x = 10
+string text = "OK"
+end type
+
+event clicked;close(parent)
+end event
@@ -2,4 +2,4 @@ module pbls
 
 go 1.23.3
 
-require github.com/sanity-io/litter v1.5.5 // indirect
+require github.com/sanity-io/litter v1.5.5
@@ -1,12 +1,36 @@
 package ast
 
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// Span is the source range covered by a node. End points just past the last
+// character of the node.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) Range() Span {
+	return s
+}
+
+type Node interface {
+	Range() Span
+}
+
 type Stmt interface {
+	Node
 	stmt()
 }
 type Expr interface {
+	Node
 	expr()
 }
 
 type Type interface {
+	Node
 	_type()
 }
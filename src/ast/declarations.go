@@ -0,0 +1,153 @@
+package ast
+
+type AccessModifier int
+
+const (
+	DefaultAccess AccessModifier = iota
+	PublicAccess
+	ProtectedAccess
+	PrivateAccess
+)
+
+type Parameter struct {
+	Span
+	Name     string
+	Type     Type
+	ByRef    bool
+	ReadOnly bool
+}
+
+// FunctionDecl is a function or subroutine. Prototypes, e.g. inside
+// `forward prototypes`, have no body.
+type FunctionDecl struct {
+	Span
+	Access       AccessModifier
+	Global       bool
+	IsSubroutine bool
+	ReturnType   Type
+	Name         string
+	Params       []Parameter
+	Throws       []Type
+	Body         *BlockStmt
+}
+
+func (n FunctionDecl) stmt() {}
+
+// ExternalFunctionDecl is a function or subroutine exported by a DLL, e.g.
+// `function ulong GetTickCount() library "kernel32.dll"`.
+type ExternalFunctionDecl struct {
+	Span
+	Access       AccessModifier
+	Global       bool
+	IsSubroutine bool
+	ReturnType   Type
+	Name         string
+	Params       []Parameter
+	Throws       []Type
+	Library      string
+	// Alias is the name of the function inside the library, set by
+	// `alias for "MessageBoxW"` when it differs from Name.
+	Alias string
+}
+
+func (n ExternalFunctionDecl) stmt() {}
+
+// EventDecl is an event script or, without a body, the declaration of a user
+// event inside a type.
+type EventDecl struct {
+	Span
+	ReturnType Type
+	Name       string
+	// EventID maps a user event to a system message, e.g. "pbm_keydown".
+	EventID string
+	Params  []Parameter
+	Throws  []Type
+	Body    *BlockStmt
+}
+
+func (n EventDecl) stmt() {}
+
+// SourceFile is an object exported from a PowerBuilder library, such as a
+// window (.srw) or user object (.sru).
+type SourceFile struct {
+	Span
+	// Header is the file name recorded by `$PBExportHeader$`, e.g. "w_main.srw".
+	Header   string
+	Comments string
+	Body     []Stmt
+}
+
+// ForwardDecl is the `forward ... end forward` block declaring the types of
+// an export ahead of their definition.
+type ForwardDecl struct {
+	Span
+	Body BlockStmt
+}
+
+func (n ForwardDecl) stmt() {}
+
+// PrototypesDecl is the `forward prototypes ... end prototypes` block
+// declaring the functions of an object or, when External is set, the `type
+// prototypes` block declaring its external functions.
+type PrototypesDecl struct {
+	Span
+	External bool
+	Body     BlockStmt
+}
+
+func (n PrototypesDecl) stmt() {}
+
+// TypeDecl is a `type ... from ... end type` block. Its properties are the
+// variables declared by the type and the initial values of inherited ones.
+type TypeDecl struct {
+	Span
+	Global          bool
+	Name            string
+	Ancestor        Type
+	Within          Type
+	AutoInstantiate bool
+	Descriptors     []DescriptorDecl
+	Properties      []VarDeclStmt
+	Events          []EventDecl
+}
+
+func (n TypeDecl) stmt() {}
+
+// DescriptorDecl is a `descriptor "name" = "value"` line of a TypeDecl.
+type DescriptorDecl struct {
+	Span
+	Name  string
+	Value string
+}
+
+func (n DescriptorDecl) stmt() {}
+
+type VariableScope int
+
+const (
+	LocalScope VariableScope = iota
+	InstanceScope
+	SharedScope
+	GlobalScope
+)
+
+// VariablesDecl is a `type variables`, `shared variables` or `global
+// variables` section.
+type VariablesDecl struct {
+	Span
+	Scope     VariableScope
+	Variables []VarDeclStmt
+}
+
+func (n VariablesDecl) stmt() {}
+
+// OnDecl is an `on w_main.create ... end on` script. Object is empty for the
+// older `on clicked` form.
+type OnDecl struct {
+	Span
+	Object string
+	Event  string
+	Body   BlockStmt
+}
+
+func (n OnDecl) stmt() {}
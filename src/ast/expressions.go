@@ -2,25 +2,39 @@ package ast
 
 import "pbls/src/lexer"
 
+// BadExpr takes the place of an expression that could not be parsed.
+type BadExpr struct {
+	Span
+}
+
+func (n BadExpr) expr() {}
+
 type NumberExpr struct {
+	Span
 	Value float64
 }
 
 func (n NumberExpr) expr() {}
 
+// StringExpr is a string literal. Value has its tilde escapes decoded, Raw
+// is the text between the quotes as written.
 type StringExpr struct {
+	Span
 	Value string
+	Raw   string
 }
 
 func (n StringExpr) expr() {}
 
 type SymbolExpr struct {
+	Span
 	Value string
 }
 
 func (n SymbolExpr) expr() {}
 
 type BinaryExpr struct {
+	Span
 	Left     Expr
 	Operator lexer.Token
 	Right    Expr
@@ -29,16 +43,98 @@ type BinaryExpr struct {
 func (n BinaryExpr) expr() {}
 
 type PrefixExpr struct {
+	Span
 	Operator lexer.Token
 	Value    Expr
 }
 
 func (n PrefixExpr) expr() {}
 
-type AssignmentExpr struct {
-	Assigne  Expr
+// PostfixExpr is an increment or decrement, `li_count++`.
+type PostfixExpr struct {
+	Span
 	Operator lexer.Token
 	Value    Expr
 }
 
-func (n AssignmentExpr) expr() {}
+func (n PostfixExpr) expr() {}
+
+// GroupingExpr is an expression in parentheses, `(li_a + li_b)`.
+type GroupingExpr struct {
+	Span
+	Value Expr
+}
+
+func (n GroupingExpr) expr() {}
+
+type BooleanExpr struct {
+	Span
+	Value bool
+}
+
+func (n BooleanExpr) expr() {}
+
+// CallExpr is a call of a function or event, e.g. `dw_1.post event
+// ue_load(1)` or `super::of_init()`.
+type CallExpr struct {
+	Span
+	Method    Expr
+	Arguments []Expr
+	IsEvent   bool
+	IsDynamic bool
+	// IsPost queues the call with POST. It is false for calls that run
+	// synchronously, with or without TRIGGER.
+	IsPost bool
+	// Qualifiers holds the POST, TRIGGER, STATIC, DYNAMIC, FUNCTION and EVENT
+	// keywords in front of the name as written.
+	Qualifiers []lexer.Token
+	// Ancestor is the qualifier in front of `::`, e.g. "super".
+	Ancestor string
+}
+
+func (n CallExpr) expr() {}
+
+type MemberExpr struct {
+	Span
+	Member   Expr
+	Property string
+}
+
+func (n MemberExpr) expr() {}
+
+// IndexExpr is an array access. Multi-dimensional arrays take one index per
+// dimension, `Control[]` has none.
+type IndexExpr struct {
+	Span
+	Member  Expr
+	Indexes []Expr
+}
+
+func (n IndexExpr) expr() {}
+
+// CreateExpr is `create Type` or `create using ls_class`; Using is only set
+// for the latter.
+type CreateExpr struct {
+	Span
+	Type  Type
+	Using Expr
+}
+
+func (n CreateExpr) expr() {}
+
+// EnumExpr is an enumerated value such as `center!`. Value holds the name
+// without the exclamation mark.
+type EnumExpr struct {
+	Span
+	Value string
+}
+
+func (n EnumExpr) expr() {}
+
+// ArrayLiteralExpr is an array initializer such as `{1, 2, 3}`.
+type ArrayLiteralExpr struct {
+	Span
+	Elements []Expr
+}
+
+func (n ArrayLiteralExpr) expr() {}
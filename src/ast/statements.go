@@ -1,28 +1,224 @@
 package ast
 
+import "pbls/src/lexer"
+
+// BadStmt takes the place of a statement that could not be parsed.
+type BadStmt struct {
+	Span
+}
+
+func (n BadStmt) stmt() {}
+
 type BlockStmt struct {
+	Span
 	Body []Stmt
 }
 
 func (n BlockStmt) stmt() {}
 
 type ExprStmt struct {
+	Span
 	Expr Expr
 }
 
 func (n ExprStmt) stmt() {}
 
+// AssignStmt is an assignment such as `ll_row = dw_1.getrow()` or
+// `li_count += 1`. A `=` inside an expression is a comparison instead.
+type AssignStmt struct {
+	Span
+	Target   Expr
+	Operator lexer.Token
+	Value    Expr
+}
+
+func (n AssignStmt) stmt() {}
+
 type VarDeclStmt struct {
+	Span
 	Identifier    string
 	IsConstant    bool
 	AssignedValue Expr
 	ExplicitType  Type
+	Scope         VariableScope
+	Access        AccessModifier
+	// ReadAccess and WriteAccess narrow Access for reading or writing, as
+	// in `public privatewrite long il_count`.
+	ReadAccess  AccessModifier
+	WriteAccess AccessModifier
 }
 
 func (n VarDeclStmt) stmt() {}
 
 type MultiVarDeclStmt struct {
+	Span
 	Stmts []VarDeclStmt
 }
 
 func (n MultiVarDeclStmt) stmt() {}
+
+// IfStmt covers both the block form terminated by END IF and the single-line
+// form. ELSEIF branches are chained as an IfStmt in Alternate, an ELSE branch
+// is stored as a BlockStmt.
+type IfStmt struct {
+	Span
+	Condition  Expr
+	Consequent BlockStmt
+	Alternate  Stmt
+	SingleLine bool
+}
+
+func (n IfStmt) stmt() {}
+
+type ReturnStmt struct {
+	Span
+	Value Expr
+}
+
+func (n ReturnStmt) stmt() {}
+
+type ExitStmt struct {
+	Span
+}
+
+func (n ExitStmt) stmt() {}
+
+type ContinueStmt struct {
+	Span
+}
+
+func (n ContinueStmt) stmt() {}
+
+type HaltStmt struct {
+	Span
+	Close bool
+}
+
+func (n HaltStmt) stmt() {}
+
+type GotoStmt struct {
+	Span
+	Label string
+}
+
+func (n GotoStmt) stmt() {}
+
+type LabelStmt struct {
+	Span
+	Name string
+}
+
+func (n LabelStmt) stmt() {}
+
+type ChooseCaseStmt struct {
+	Span
+	Subject Expr
+	Cases   []CaseClause
+}
+
+func (n ChooseCaseStmt) stmt() {}
+
+// CaseClause is a single CASE of a CHOOSE CASE statement. The CASE ELSE clause
+// has no conditions.
+type CaseClause struct {
+	Span
+	Conditions []CaseCondition
+	IsElse     bool
+	Body       BlockStmt
+}
+
+type CaseCondition interface {
+	Node
+	caseCondition()
+}
+
+// CaseValue matches a single value, e.g. `CASE 1, 3, 5`.
+type CaseValue struct {
+	Span
+	Value Expr
+}
+
+func (n CaseValue) caseCondition() {}
+
+// CaseRange matches an inclusive range, e.g. `CASE 10 TO 20`.
+type CaseRange struct {
+	Span
+	From Expr
+	To   Expr
+}
+
+func (n CaseRange) caseCondition() {}
+
+// CaseIs matches a comparison with the subject, e.g. `CASE IS > 100`.
+type CaseIs struct {
+	Span
+	Operator lexer.Token
+	Value    Expr
+}
+
+func (n CaseIs) caseCondition() {}
+
+type ForStmt struct {
+	Span
+	Variable Expr
+	From     Expr
+	To       Expr
+	Step     Expr
+	Body     BlockStmt
+}
+
+func (n ForStmt) stmt() {}
+
+// DoLoopStmt covers DO WHILE/DO UNTIL ... LOOP and DO ... LOOP WHILE/LOOP UNTIL.
+// TestAtEnd is set when the condition follows LOOP.
+type DoLoopStmt struct {
+	Span
+	Condition Expr
+	Until     bool
+	TestAtEnd bool
+	Body      BlockStmt
+}
+
+func (n DoLoopStmt) stmt() {}
+
+type TryStmt struct {
+	Span
+	Body    BlockStmt
+	Catches []CatchClause
+	Finally *BlockStmt
+}
+
+func (n TryStmt) stmt() {}
+
+// CatchClause is a `CATCH (ExceptionType identifier)` block of a TryStmt.
+type CatchClause struct {
+	Span
+	ExceptionType Type
+	Identifier    string
+	Body          BlockStmt
+}
+
+type ThrowStmt struct {
+	Span
+	Value Expr
+}
+
+func (n ThrowStmt) stmt() {}
+
+type DestroyStmt struct {
+	Span
+	Value Expr
+}
+
+func (n DestroyStmt) stmt() {}
+
+// CallStmt runs the script of an ancestor event, e.g. `call super::open` or
+// `call w_base`cb_ok::clicked`.
+type CallStmt struct {
+	Span
+	Ancestor string
+	Control  string
+	Event    string
+}
+
+func (n CallStmt) stmt() {}
@@ -1,13 +1,29 @@
 package ast
 
 type SymbolType struct {
+	Span
 	Name string
+	// Precision is the `{n}` suffix of `decimal{2}` or `blob{100}`: the number
+	// of decimal places or the size in bytes. It is nil when omitted.
+	Precision *int
 }
 
 func (t SymbolType) _type() {}
 
+// ArrayType is an array of Underlying. Unbounded arrays, `long ll_ids[]`, have
+// no dimensions.
 type ArrayType struct {
+	Span
 	Underlying Type
+	Dimensions []ArrayDimension
 }
 
 func (t ArrayType) _type() {}
+
+// ArrayDimension is one dimension of a bounded array, `[5]` or `[1 to 10]`.
+// Lower is nil when only the upper bound is given.
+type ArrayDimension struct {
+	Span
+	Lower Expr
+	Upper Expr
+}
@@ -0,0 +1,52 @@
+package diagnostic
+
+import "fmt"
+
+type Severity int
+
+// Severities share their values with the Language Server Protocol.
+const (
+	Error Severity = iota + 1
+	Warning
+	Information
+	Hint
+)
+
+type Code string
+
+const (
+	UnrecognizedToken   Code = "PB1001"
+	UnterminatedString  Code = "PB1002"
+	UnterminatedComment Code = "PB1003"
+	InvalidEscape       Code = "PB1004"
+
+	UnexpectedToken Code = "PB2001"
+	ExpectedExpr    Code = "PB2002"
+	ExpectedType    Code = "PB2003"
+)
+
+type Diagnostic struct {
+	Code        Code
+	Message     string
+	Severity    Severity
+	StartLine   int
+	StartColumn int
+	EndLine     int
+	EndColumn   int
+}
+
+func New(code Code, severity Severity, line, column, length int, message string) Diagnostic {
+	return Diagnostic{
+		Code:        code,
+		Message:     message,
+		Severity:    severity,
+		StartLine:   line,
+		StartColumn: column,
+		EndLine:     line,
+		EndColumn:   column + length,
+	}
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.StartLine, d.StartColumn, d.Message, d.Code)
+}
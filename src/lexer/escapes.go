@@ -0,0 +1,91 @@
+package lexer
+
+import (
+	"strconv"
+	"strings"
+)
+
+// simple_escapes_lu maps the character following a tilde to the character it
+// stands for.
+var simple_escapes_lu map[byte]string = map[byte]string{
+	'n':  "\n",
+	't':  "\t",
+	'v':  "\v",
+	'r':  "\r",
+	'f':  "\f",
+	'b':  "\b",
+	'"':  "\"",
+	'\'': "'",
+	'~':  "~",
+}
+
+// UnescapeString decodes the tilde escapes in the raw text of a string
+// literal, e.g. `~"hi~"~r~n`. Invalid escapes are kept as written; the lexer
+// reports them while scanning the string.
+func UnescapeString(raw string) string {
+	if strings.IndexByte(raw, '~') < 0 {
+		return raw
+	}
+	var b strings.Builder
+	for i := 0; i < len(raw); {
+		if raw[i] != '~' {
+			b.WriteByte(raw[i])
+			i++
+			continue
+		}
+		decoded, n, _ := unescape(raw[i:])
+		b.WriteString(decoded)
+		i += n
+	}
+	return b.String()
+}
+
+// unescape decodes the escape sequence at the start of s, which starts with a
+// tilde. It returns the decoded text, the length of the sequence and whether
+// the sequence is valid. An invalid sequence decodes to itself.
+func unescape(s string) (string, int, bool) {
+	if len(s) < 2 || s[1] == '\n' || s[1] == '\r' {
+		return s[:1], 1, false
+	}
+	c := s[1]
+	if decoded, exists := simple_escapes_lu[c]; exists {
+		return decoded, 2, true
+	}
+
+	switch {
+	case c == 'h' || c == 'H':
+		return unescapeNumber(s, 2, 2, 16)
+	case c == 'o' || c == 'O':
+		return unescapeNumber(s, 2, 3, 8)
+	case isDigit(c):
+		return unescapeNumber(s, 1, 3, 10)
+	}
+	return s[:2], 2, false
+}
+
+// unescapeNumber decodes a character given by its code such as `~065`, `~h41`
+// or `~o101`. The code takes exactly digits digits starting at offset and may
+// not exceed 255.
+func unescapeNumber(s string, offset, digits, base int) (string, int, bool) {
+	n := offset
+	for n < len(s) && n-offset < digits && isDigitOfBase(s[n], base) {
+		n++
+	}
+	if n-offset != digits {
+		return s[:n], n, false
+	}
+	code, err := strconv.ParseUint(s[offset:n], base, 8)
+	if err != nil {
+		return s[:n], n, false
+	}
+	return string(rune(code)), n, true
+}
+func isDigitOfBase(c byte, base int) bool {
+	switch base {
+	case 8:
+		return '0' <= c && c <= '7'
+	case 16:
+		return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+	}
+	return isDigit(c)
+}
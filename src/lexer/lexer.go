@@ -2,41 +2,52 @@ package lexer
 
 import (
 	"fmt"
-	"regexp"
+	"pbls/src/diagnostic"
+	"strings"
+	"unicode/utf8"
 )
 
-type regexHandler func(lex *Lexer, regex *regexp.Regexp)
-
-type regexPattern struct {
-	regex   *regexp.Regexp
-	handler regexHandler
-}
-
 type Lexer struct {
-	patterns []regexPattern
-	Tokens   []Token
-	source   string
-	current  int
-	line     int
-	column   int
+	Tokens      []Token
+	Diagnostics []diagnostic.Diagnostic
+	source      string
+	current     int
+	line        int
+	column      int
 }
 
 func (l *Lexer) advanceN(n int) {
-	l.current += n
-	l.column += n
-	if l.current < len(l.source) {
-		curRune := rune(l.source[l.current])
-		if curRune == '\n' {
+	for i := l.current; i < l.current+n; i++ {
+		if l.source[i] == '\n' {
 			l.line++
 			l.column = 1
+		} else {
+			l.column++
 		}
 	}
+	l.current += n
 }
 func (l *Lexer) push(t Token) {
 	l.Tokens = append(l.Tokens, t)
 }
-func (l *Lexer) at() string {
-	return string(l.source[l.current])
+func (l *Lexer) pushN(kind TokenKind, n int) {
+	l.push(NewToken(kind, l.source[l.current:l.current+n], l.line, l.column, l.current))
+	l.advanceN(n)
+}
+func (l *Lexer) report(code diagnostic.Code, length int, message string) {
+	l.reportAt(code, l.column, length, message)
+}
+func (l *Lexer) reportAt(code diagnostic.Code, column, length int, message string) {
+	l.Diagnostics = append(l.Diagnostics, diagnostic.New(code, diagnostic.Error, l.line, column, length, message))
+}
+func (l *Lexer) at() byte {
+	return l.source[l.current]
+}
+func (l *Lexer) peek() byte {
+	if l.current+1 >= len(l.source) {
+		return 0
+	}
+	return l.source[l.current+1]
 }
 func (l *Lexer) remainder() string {
 	return l.source[l.current:]
@@ -44,123 +55,191 @@ func (l *Lexer) remainder() string {
 func (l *Lexer) atEOF() bool {
 	return l.current >= len(l.source)
 }
-func Tokenize(source []byte) []Token {
+func Tokenize(source []byte) ([]Token, []diagnostic.Diagnostic) {
 	lex := NewLexer(source)
 
 	for !lex.atEOF() {
-		matched := false
-
-		for _, pattern := range lex.patterns {
-			loc := pattern.regex.FindStringIndex(string(lex.remainder()))
+		lex.scanToken()
+	}
+	lex.push(NewToken(EOF, "EOF", lex.line, lex.column, lex.current))
 
-			if loc != nil && loc[0] == 0 {
-				pattern.handler(lex, pattern.regex)
-				matched = true
-				break
-			}
-		}
+	return lex.Tokens, lex.Diagnostics
+}
 
-		if !matched {
-			panic(fmt.Sprintf("Lexer::Error -> unrecoginized token at line %d column %d near %s\n", lex.line, lex.column, string(lex.remainder())))
-		}
+func (l *Lexer) scanToken() {
+	c := l.at()
+	switch {
+	case isIdentifierStart(c):
+		l.scanSymbol()
+	case isDigit(c):
+		l.scanNumber()
+	case c == '"' || c == '\'':
+		l.scanString(c)
+	case c == ' ' || c == '\t':
+		l.advanceN(l.countWhile(l.current, isBlank))
+	case c == '\n':
+		l.push(NewToken(NEWLINE, "n", l.line, l.column, l.current))
+		l.advanceN(1)
+	case c == '\r' && l.peek() == '\n':
+		l.push(NewToken(NEWLINE, "rn", l.line, l.column, l.current))
+		l.advanceN(2)
+	case c == '/' && l.peek() == '/':
+		l.advanceN(l.lineLength())
+	case c == '/' && l.peek() == '*':
+		l.scanBlockComment()
+	case c == '$':
+		l.scanExportDirective()
+	case c == '&':
+		l.scanContinuation()
+	default:
+		l.scanOperator()
 	}
-	lex.push(NewToken(EOF, "EOF", lex.line, 0))
-
-	return lex.Tokens
 }
 
-func numberHandler(lex *Lexer, regex *regexp.Regexp) {
-	match := regex.FindString(string(lex.remainder()))
-	lex.push(NewToken(NUMBER, match, lex.line, lex.column))
-	lex.advanceN(len(match))
+// lineLength returns the number of bytes up to the end of the current line.
+func (l *Lexer) lineLength() int {
+	n := strings.IndexByte(l.remainder(), '\n')
+	if n < 0 {
+		return len(l.remainder())
+	}
+	return n
 }
-func skipHandler(lex *Lexer, regex *regexp.Regexp) {
-	match := regex.FindStringIndex(string(lex.remainder()))
-	lex.advanceN(match[1])
+func (l *Lexer) countWhile(start int, predicate func(c byte) bool) int {
+	end := start
+	for end < len(l.source) && predicate(l.source[end]) {
+		end++
+	}
+	return end - l.current
 }
-func stringHandler(lex *Lexer, regex *regexp.Regexp) {
-	match := regex.FindStringIndex(lex.remainder())
-	stringLiteral := lex.remainder()[match[0]+1 : match[1]-1]
 
-	lex.push(NewToken(STRING, stringLiteral, lex.line, lex.column))
-	lex.advanceN(len(stringLiteral) + 2)
+func (l *Lexer) scanSymbol() {
+	n := l.countWhile(l.current, isIdentifierPart)
+	match := l.source[l.current : l.current+n]
+
+	// Enumerated values such as `center!` are written as a name directly
+	// followed by an exclamation mark.
+	if l.current+n < len(l.source) && l.source[l.current+n] == '!' {
+		l.pushN(ENUM_VALUE, n+1)
+	} else if kind, exists := reserved_lu[strings.ToLower(match)]; exists {
+		l.pushN(kind, n)
+	} else if _, exists := types_lu[strings.ToLower(match)]; exists {
+		l.pushN(IDENTIFIER_TYPE, n)
+	} else {
+		l.pushN(IDENTIFIER, n)
+	}
+}
+func (l *Lexer) scanNumber() {
+	n := l.countWhile(l.current, isDigit)
+	if l.current+n+1 < len(l.source) && l.source[l.current+n] == '.' && isDigit(l.source[l.current+n+1]) {
+		n = l.countWhile(l.current+n+1, isDigit)
+	}
+	l.pushN(NUMBER, n)
 }
-func symbolHandler(lex *Lexer, regex *regexp.Regexp) {
-	match := regex.FindString(lex.remainder())
 
-	if kind, exists := reserved_lu[match]; exists {
-		lex.push(NewToken(kind, match, lex.line, lex.column))
-	} else {
-		lex.push(NewToken(IDENTIFIER, match, lex.line, lex.column))
+// scanString scans a string literal up to the closing quote on the same line.
+// A tilde escapes the character after it, so `~"` does not end the string.
+// The token holds the raw text between the quotes; see UnescapeString.
+func (l *Lexer) scanString(quote byte) {
+	end := l.current + 1
+	for end < len(l.source) && l.source[end] != quote && l.source[end] != '\n' {
+		if l.source[end] != '~' {
+			end++
+			continue
+		}
+		_, n, valid := unescape(l.source[end:])
+		if !valid {
+			l.reportAt(diagnostic.InvalidEscape, l.column+end-l.current, n, fmt.Sprintf("Invalid escape sequence '%s'", l.source[end:end+n]))
+		}
+		end += n
+	}
+	if end >= len(l.source) || l.source[end] != quote {
+		n := l.lineLength()
+		l.report(diagnostic.UnterminatedString, n, "Unterminated string literal")
+		l.advanceN(n)
+		return
 	}
 
-	lex.advanceN(len(match))
+	l.push(NewToken(STRING, l.source[l.current+1:end], l.line, l.column, l.current))
+	l.advanceN(end + 1 - l.current)
 }
-func defaultHandler(kind TokenKind, value string) regexHandler {
-	return func(lex *Lexer, regex *regexp.Regexp) {
-		lex.push(NewToken(kind, value, lex.line, lex.column))
-		lex.advanceN(len(value))
+func (l *Lexer) scanBlockComment() {
+	end := strings.Index(l.source[l.current+2:], "*/")
+	if end < 0 {
+		l.report(diagnostic.UnterminatedComment, 2, "Unterminated block comment")
+		l.advanceN(len(l.remainder()))
+		return
 	}
+	l.advanceN(end + 4)
 }
-func newLineHandler(kind TokenKind, value string) regexHandler {
-	return func(lex *Lexer, regex *regexp.Regexp) {
-		lex.push(NewToken(kind, value, lex.line, lex.column))
-		lex.advanceN(len(value))
-		lex.line++
-		lex.column = 1
+
+// scanContinuation skips a `&` at the end of a line together with the line
+// break, so the statement carries on with the next line.
+func (l *Lexer) scanContinuation() {
+	n := l.countWhile(l.current+1, isBlank)
+	if strings.HasPrefix(l.source[l.current+n:], "//") {
+		n += strings.IndexByte(l.source[l.current+n:]+"\n", '\n')
+	}
+	rest := l.source[l.current+n:]
+	switch {
+	case strings.HasPrefix(rest, "\r\n"):
+		n += 2
+	case strings.HasPrefix(rest, "\n"):
+		n += 1
+	case rest != "":
+		l.report(diagnostic.UnrecognizedToken, 1, "The continuation character '&' must end the line")
+		n = 1
 	}
+	l.advanceN(n)
 }
+
+// scanExportDirective turns a `$PBExportHeader$` or `$PBExportComments$` line
+// into a single token holding the whole line.
+func (l *Lexer) scanExportDirective() {
+	for prefix, kind := range export_directives_lu {
+		if strings.HasPrefix(l.remainder(), prefix) {
+			l.pushN(kind, len(strings.TrimRight(l.remainder()[:l.lineLength()], "\r")))
+			return
+		}
+	}
+	l.scanOperator()
+}
+func (l *Lexer) scanOperator() {
+	if l.current+2 <= len(l.source) {
+		if kind, exists := double_operators_lu[l.source[l.current:l.current+2]]; exists {
+			l.pushN(kind, 2)
+			return
+		}
+	}
+	if kind, exists := single_operators_lu[l.at()]; exists {
+		l.pushN(kind, 1)
+		return
+	}
+
+	r, size := utf8.DecodeRuneInString(l.remainder())
+	l.report(diagnostic.UnrecognizedToken, size, fmt.Sprintf("Unrecognized token '%c'", r))
+	l.advanceN(size)
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || isDigit(c)
+}
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
 func NewLexer(source []byte) *Lexer {
 	return &Lexer{
+		// Scripts average a token every few bytes; reserving up front avoids
+		// repeatedly copying the token slice on large exports.
+		Tokens: make([]Token, 0, len(source)/4),
 		source: string(source),
 		line:   1,
 		column: 1,
-		patterns: []regexPattern{
-			{regexp.MustCompile(`string`), defaultHandler(IDENTIFIER_TYPE, "string")},
-			{regexp.MustCompile(`long`), defaultHandler(IDENTIFIER_TYPE, "long")},
-			{regexp.MustCompile(`int`), defaultHandler(IDENTIFIER_TYPE, "int")},
-			{regexp.MustCompile(`char`), defaultHandler(IDENTIFIER_TYPE, "char")},
-
-			{regexp.MustCompile(`[a-zA-Z_][a-zA-Z_0-9]*`), symbolHandler},
-			{regexp.MustCompile(`[0-9]+(\.[0-9]+)?`), numberHandler},
-			{regexp.MustCompile(`"[^"]*"`), stringHandler},
-			{regexp.MustCompile(`'[^']*'`), stringHandler},
-			{regexp.MustCompile(`\/\/.*`), skipHandler},
-			{regexp.MustCompile(`\/\*[\s\S]*?\*\/`), skipHandler},
-			{regexp.MustCompile(`[ \t]+`), skipHandler},
-			{regexp.MustCompile(`\n`), defaultHandler(NEWLINE, "n")},
-			{regexp.MustCompile(`\r\n`), defaultHandler(NEWLINE, "rn")},
-
-			{regexp.MustCompile(`\[`), defaultHandler(OPEN_BRACKET, "[")},
-			{regexp.MustCompile(`\]`), defaultHandler(CLOSE_BRACKET, "]")},
-			{regexp.MustCompile(`\{`), defaultHandler(OPEN_CURLY, "{")},
-			{regexp.MustCompile(`\}`), defaultHandler(CLOSE_CURLY, "}")},
-			{regexp.MustCompile(`\(`), defaultHandler(OPEN_PAREN, "(")},
-			{regexp.MustCompile(`\)`), defaultHandler(CLOSE_PAREN, ")")},
-			{regexp.MustCompile(`=`), defaultHandler(EQUALS, "=")},
-			{regexp.MustCompile(`!=`), defaultHandler(NOT_EQUALS, "!=")},
-			{regexp.MustCompile(`!`), defaultHandler(NOT, "!")},
-			{regexp.MustCompile(`>=`), defaultHandler(GREATER_EQUAL, ">=")},
-			{regexp.MustCompile(`>`), defaultHandler(GREATER, ">")},
-			{regexp.MustCompile(`<=`), defaultHandler(LESS_EQUAL, "<=")},
-			{regexp.MustCompile(`<`), defaultHandler(LESS, "<")},
-			{regexp.MustCompile(`\.`), defaultHandler(DOT, ".")},
-			{regexp.MustCompile(`;`), defaultHandler(SEMICOLON, ";")},
-			{regexp.MustCompile(`:`), defaultHandler(COLON, ":")},
-			{regexp.MustCompile(`\?`), defaultHandler(QUESTION, "?")},
-			{regexp.MustCompile(`,`), defaultHandler(COMMA, ",")},
-			{regexp.MustCompile("`"), defaultHandler(BACKTICK, "`")},
-			{regexp.MustCompile(`\+\+`), defaultHandler(PLUS_PLUS, "++")},
-			{regexp.MustCompile(`--`), defaultHandler(MINUS_MINUS, "--")},
-			{regexp.MustCompile(`\+=`), defaultHandler(PLUS_EQUALS, "+=")},
-			{regexp.MustCompile(`-=`), defaultHandler(MINUS_EQUALS, "-=")},
-			{regexp.MustCompile(`/=`), defaultHandler(SLASH_EQUALS, "/=")},
-			{regexp.MustCompile(`\*=`), defaultHandler(STAR_EQUALS, "*=")},
-			{regexp.MustCompile(`\+`), defaultHandler(PLUS, "+")},
-			{regexp.MustCompile(`-`), defaultHandler(MINUS, "-")},
-			{regexp.MustCompile(`/`), defaultHandler(SLASH, "/")},
-			{regexp.MustCompile(`\*`), defaultHandler(STAR, "*")},
-			{regexp.MustCompile(`%`), defaultHandler(PERCENT, "%")},
-		},
 	}
 }
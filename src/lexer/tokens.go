@@ -1,6 +1,9 @@
 package lexer
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type TokenKind int
 
@@ -29,6 +32,7 @@ const (
 	DOT
 	SEMICOLON
 	COLON
+	COLON_COLON
 	QUESTION
 	COMMA
 	BACKTICK
@@ -40,16 +44,18 @@ const (
 	SLASH_EQUALS
 	STAR_EQUALS
 	PERCENT_EQUALS
+	CARET_EQUALS
 
 	PLUS
 	MINUS
 	SLASH
 	STAR
 	PERCENT
+	CARET
 
 	ALIAS
 	AND
-	AUTOINSTANCIATE
+	AUTOINSTANTIATE
 	CALL
 	CASE
 	CATCH
@@ -155,12 +161,15 @@ const (
 
 	IDENTIFIER_TYPE
 	NEWLINE
+	ENUM_VALUE
+	EXPORT_HEADER
+	EXPORT_COMMENTS
 )
 
 var reserved_lu map[string]TokenKind = map[string]TokenKind{
 	"alias":           ALIAS,
 	"and":             AND,
-	"autoinstanciate": AUTOINSTANCIATE,
+	"autoinstantiate": AUTOINSTANTIATE,
 	"call":            CALL,
 	"case":            CASE,
 	"catch":           CATCH,
@@ -212,6 +221,7 @@ var reserved_lu map[string]TokenKind = map[string]TokenKind{
 	"namespace":       NAMESPACE,
 	"native":          NATIVE,
 	"next":            NEXT,
+	"not":             NOT,
 	"notof":           NOTOF,
 	"on":              ON,
 	"open":            OPEN,
@@ -265,22 +275,121 @@ var reserved_lu map[string]TokenKind = map[string]TokenKind{
 	"_debug":          _DEBUG,
 }
 
+var single_operators_lu map[byte]TokenKind = map[byte]TokenKind{
+	'[': OPEN_BRACKET,
+	']': CLOSE_BRACKET,
+	'{': OPEN_CURLY,
+	'}': CLOSE_CURLY,
+	'(': OPEN_PAREN,
+	')': CLOSE_PAREN,
+	'=': EQUALS,
+	'>': GREATER,
+	'<': LESS,
+	'.': DOT,
+	';': SEMICOLON,
+	':': COLON,
+	'?': QUESTION,
+	',': COMMA,
+	'`': BACKTICK,
+	'+': PLUS,
+	'-': MINUS,
+	'/': SLASH,
+	'*': STAR,
+	'%': PERCENT,
+	'^': CARET,
+}
+
+var double_operators_lu map[string]TokenKind = map[string]TokenKind{
+	"<>": NOT_EQUALS,
+	"::": COLON_COLON,
+	">=": GREATER_EQUAL,
+	"<=": LESS_EQUAL,
+	"++": PLUS_PLUS,
+	"--": MINUS_MINUS,
+	"+=": PLUS_EQUALS,
+	"-=": MINUS_EQUALS,
+	"/=": SLASH_EQUALS,
+	"*=": STAR_EQUALS,
+	"%=": PERCENT_EQUALS,
+	"^=": CARET_EQUALS,
+}
+
+// export_directives_lu maps the prefixes of the lines PowerBuilder writes at the
+// top of an exported object.
+var export_directives_lu map[string]TokenKind = map[string]TokenKind{
+	"$PBExportHeader$":   EXPORT_HEADER,
+	"$PBExportComments$": EXPORT_COMMENTS,
+}
+
+// types_lu maps the spellings of the built-in datatypes to their canonical name.
+var types_lu map[string]string = map[string]string{
+	"any":             "any",
+	"blob":            "blob",
+	"boolean":         "boolean",
+	"byte":            "byte",
+	"char":            "char",
+	"character":       "char",
+	"date":            "date",
+	"datetime":        "datetime",
+	"dec":             "decimal",
+	"decimal":         "decimal",
+	"double":          "double",
+	"int":             "integer",
+	"integer":         "integer",
+	"long":            "long",
+	"longlong":        "longlong",
+	"longptr":         "longptr",
+	"real":            "real",
+	"string":          "string",
+	"time":            "time",
+	"uint":            "unsignedinteger",
+	"unsignedint":     "unsignedinteger",
+	"unsignedinteger": "unsignedinteger",
+	"ulong":           "unsignedlong",
+	"unsignedlong":    "unsignedlong",
+}
+
+// TypeName returns the canonical name of a built-in datatype, e.g. "integer" for "Int".
+func TypeName(name string) (string, bool) {
+	canonical, exists := types_lu[strings.ToLower(name)]
+	return canonical, exists
+}
+
 type Token struct {
 	Kind   TokenKind
 	Value  string
 	Line   int
 	Column int
+	Offset int
 }
 
-func NewToken(kind TokenKind, value string, line int, column int) Token {
+func NewToken(kind TokenKind, value string, line int, column int, offset int) Token {
 	return Token{
 		Kind:   kind,
 		Value:  value,
 		Line:   line,
 		Column: column,
+		Offset: offset,
 	}
 }
-func (t *Token) isOneOfMany(expected ...TokenKind) bool {
+
+// Length returns the number of bytes the token occupies in the source.
+func (t Token) Length() int {
+	switch t.Kind {
+	case EOF:
+		return 0
+	case STRING:
+		return len(t.Value) + 2
+	default:
+		return len(t.Value)
+	}
+}
+
+// IsKeyword reports whether kind is one of the reserved words.
+func IsKeyword(kind TokenKind) bool {
+	return kind >= ALIAS && kind <= _DEBUG
+}
+func (t Token) IsOneOfMany(expected ...TokenKind) bool {
 	for _, tkn := range expected {
 		if tkn == t.Kind {
 			return true
@@ -289,7 +398,7 @@ func (t *Token) isOneOfMany(expected ...TokenKind) bool {
 	return false
 }
 func (t *Token) Debug() {
-	if t.isOneOfMany(IDENTIFIER, NUMBER, STRING) {
+	if t.IsOneOfMany(IDENTIFIER, NUMBER, STRING) {
 		fmt.Printf("%s (%s)\n", TokenKindString(t.Kind), t.Value)
 	} else {
 		fmt.Printf("%s ()\n", TokenKindString(t.Kind))
@@ -320,9 +429,9 @@ func TokenKindString(kind TokenKind) string {
 	case EQUALS:
 		return "="
 	case NOT:
-		return "!"
+		return "not"
 	case NOT_EQUALS:
-		return "!="
+		return "<>"
 
 	case GREATER:
 		return ">"
@@ -339,6 +448,8 @@ func TokenKindString(kind TokenKind) string {
 		return ";"
 	case COLON:
 		return ":"
+	case COLON_COLON:
+		return "::"
 	case QUESTION:
 		return "?"
 	case COMMA:
@@ -358,6 +469,10 @@ func TokenKindString(kind TokenKind) string {
 		return "/="
 	case STAR_EQUALS:
 		return "*="
+	case PERCENT_EQUALS:
+		return "%="
+	case CARET_EQUALS:
+		return "^="
 
 	case PLUS:
 		return "+"
@@ -369,13 +484,15 @@ func TokenKindString(kind TokenKind) string {
 		return "*"
 	case PERCENT:
 		return "%"
+	case CARET:
+		return "^"
 
 	case ALIAS:
 		return "alias"
 	case AND:
 		return "and"
-	case AUTOINSTANCIATE:
-		return "autoinstanciate"
+	case AUTOINSTANTIATE:
+		return "autoinstantiate"
 	case CALL:
 		return "call"
 	case CASE:
@@ -584,6 +701,12 @@ func TokenKindString(kind TokenKind) string {
 		return "identifier type"
 	case NEWLINE:
 		return "new line"
+	case ENUM_VALUE:
+		return "enumerated value"
+	case EXPORT_HEADER:
+		return "$PBExportHeader$"
+	case EXPORT_COMMENTS:
+		return "$PBExportComments$"
 	default:
 		fmt.Printf("Unexpected Token %d", kind)
 	}
@@ -0,0 +1,175 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"pbls/src/ast"
+	"pbls/src/diagnostic"
+	"pbls/src/lexer"
+	"pbls/src/parser"
+	"strings"
+	"unicode/utf16"
+)
+
+const serverName = "pbls"
+
+func handleInitialize(s *Server, params json.RawMessage) (any, error) {
+	var initParams InitializeParams
+	if err := decodeParams(params, &initParams); err != nil {
+		return nil, err
+	}
+	s.initialized = true
+
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync: TextDocumentSyncOptions{
+				OpenClose: true,
+				Change:    SyncFull,
+				Save:      SaveOptions{IncludeText: true},
+			},
+			DocumentSymbolProvider: true,
+		},
+		ServerInfo: ServerInfo{Name: serverName},
+	}, nil
+}
+func handleInitialized(s *Server, params json.RawMessage) error {
+	return nil
+}
+func handleShutdown(s *Server, params json.RawMessage) (any, error) {
+	s.shutdown = true
+	return nil, nil
+}
+func handleExit(s *Server, params json.RawMessage) error {
+	s.exited = true
+	return nil
+}
+
+func handleDidOpen(s *Server, params json.RawMessage) error {
+	var openParams DidOpenTextDocumentParams
+	if err := decodeParams(params, &openParams); err != nil {
+		return err
+	}
+	item := openParams.TextDocument
+	doc := &document{
+		URI:     item.URI,
+		Version: item.Version,
+		Text:    item.Text,
+	}
+	s.documents[item.URI] = doc
+	s.analyze(doc)
+	return nil
+}
+func handleDidChange(s *Server, params json.RawMessage) error {
+	var changeParams DidChangeTextDocumentParams
+	if err := decodeParams(params, &changeParams); err != nil {
+		return err
+	}
+	doc, exists := s.documents[changeParams.TextDocument.URI]
+	if !exists {
+		return fmt.Errorf("change for unknown document %s", changeParams.TextDocument.URI)
+	}
+	// Only full synchronization is advertised, so the last change holds the whole text.
+	for _, change := range changeParams.ContentChanges {
+		doc.Text = change.Text
+	}
+	doc.Version = changeParams.TextDocument.Version
+	s.analyze(doc)
+	return nil
+}
+func handleDidSave(s *Server, params json.RawMessage) error {
+	var saveParams DidSaveTextDocumentParams
+	if err := decodeParams(params, &saveParams); err != nil {
+		return err
+	}
+	doc, exists := s.documents[saveParams.TextDocument.URI]
+	if !exists {
+		return fmt.Errorf("save for unknown document %s", saveParams.TextDocument.URI)
+	}
+	if saveParams.Text != nil {
+		doc.Text = *saveParams.Text
+	}
+	s.analyze(doc)
+	return nil
+}
+func handleDidClose(s *Server, params json.RawMessage) error {
+	var closeParams DidCloseTextDocumentParams
+	if err := decodeParams(params, &closeParams); err != nil {
+		return err
+	}
+	delete(s.documents, closeParams.TextDocument.URI)
+	s.publishDiagnostics(closeParams.TextDocument.URI, nil, nil, []diagnostic.Diagnostic{})
+	return nil
+}
+
+func (s *Server) analyze(doc *document) {
+	var lexDiagnostics, parseDiagnostics []diagnostic.Diagnostic
+
+	// Syntax errors are reported as diagnostics; anything still panicking is a
+	// bug in pbls and must not take the whole server down with it.
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("pbls: could not analyze %s: %v", doc.URI, r)
+		}
+		version := doc.Version
+		s.publishDiagnostics(doc.URI, &version, doc.Lines, append(lexDiagnostics, parseDiagnostics...))
+	}()
+
+	doc.Lines = strings.Split(doc.Text, "\n")
+	doc.Tokens, lexDiagnostics = lexer.Tokenize([]byte(doc.Text))
+	if parser.IsSourceFile(doc.URI) {
+		doc.AST, parseDiagnostics = parser.ParseSourceFile(doc.Tokens)
+		return
+	}
+	var program ast.BlockStmt
+	program, parseDiagnostics = parser.Parse(doc.Tokens)
+	doc.AST = ast.SourceFile{Span: program.Span, Body: program.Body}
+}
+
+func (s *Server) publishDiagnostics(uri string, version *int, lines []string, diagnostics []diagnostic.Diagnostic) {
+	params := PublishDiagnosticsParams{
+		URI:         uri,
+		Version:     version,
+		Diagnostics: make([]Diagnostic, 0, len(diagnostics)),
+	}
+	for _, d := range diagnostics {
+		params.Diagnostics = append(params.Diagnostics, toProtocolDiagnostic(lines, d))
+	}
+	s.notify("textDocument/publishDiagnostics", params)
+}
+
+func toProtocolDiagnostic(lines []string, d diagnostic.Diagnostic) Diagnostic {
+	return Diagnostic{
+		Range: Range{
+			Start: toProtocolPosition(lines, d.StartLine, d.StartColumn),
+			End:   toProtocolPosition(lines, d.EndLine, d.EndColumn),
+		},
+		Severity: int(d.Severity),
+		Code:     string(d.Code),
+		Source:   serverName,
+		Message:  d.Message,
+	}
+}
+
+// toProtocolPosition converts the 1-based positions of the lexer into the
+// 0-based positions of the protocol. The lexer counts the bytes of a line
+// while the protocol counts its UTF-16 code units.
+func toProtocolPosition(lines []string, line, column int) Position {
+	line, column = max(line-1, 0), max(column-1, 0)
+	character := column
+	if line < len(lines) {
+		text := lines[line]
+		character = utf16Length(text[:min(column, len(text))]) + max(column-len(text), 0)
+	}
+	return Position{
+		Line:      line,
+		Character: character,
+	}
+}
+func utf16Length(text string) int {
+	length := 0
+	for _, r := range text {
+		length += utf16.RuneLen(r)
+	}
+	return length
+}
@@ -0,0 +1,185 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"pbls/src/ast"
+	"pbls/src/lexer"
+)
+
+type requestHandler func(s *Server, params json.RawMessage) (any, error)
+type notificationHandler func(s *Server, params json.RawMessage) error
+
+type document struct {
+	URI     string
+	Version int
+	Text    string
+	Lines   []string
+	Tokens  []lexer.Token
+	AST     ast.SourceFile
+}
+
+type Server struct {
+	in          *bufio.Reader
+	out         io.Writer
+	initialized bool
+	shutdown    bool
+	exited      bool
+	documents   map[string]*document
+
+	request_lu      map[string]requestHandler
+	notification_lu map[string]notificationHandler
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	s := &Server{
+		in:              bufio.NewReader(in),
+		out:             out,
+		documents:       map[string]*document{},
+		request_lu:      map[string]requestHandler{},
+		notification_lu: map[string]notificationHandler{},
+	}
+	s.createHandlerLookups()
+	return s
+}
+
+func (s *Server) request(method string, fn requestHandler) {
+	s.request_lu[method] = fn
+}
+func (s *Server) notification(method string, fn notificationHandler) {
+	s.notification_lu[method] = fn
+}
+func (s *Server) createHandlerLookups() {
+	// Lifecycle
+	s.request("initialize", handleInitialize)
+	s.notification("initialized", handleInitialized)
+	s.request("shutdown", handleShutdown)
+	s.notification("exit", handleExit)
+
+	// Document synchronization
+	s.notification("textDocument/didOpen", handleDidOpen)
+	s.notification("textDocument/didChange", handleDidChange)
+	s.notification("textDocument/didSave", handleDidSave)
+	s.notification("textDocument/didClose", handleDidClose)
+
+	// Language features
+	s.request("textDocument/documentSymbol", handleDocumentSymbol)
+}
+
+// Run serves messages until the client sends exit or closes the input stream
+// and returns the process exit code expected by the protocol.
+func (s *Server) Run() int {
+	for !s.exited {
+		payload, err := ReadMessage(s.in)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("pbls: %s", err)
+			return 1
+		}
+		s.handle(payload)
+	}
+	if s.shutdown {
+		return 0
+	}
+	return 1
+}
+
+func (s *Server) handle(payload []byte) {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		s.reply(nil, nil, &ResponseError{Code: ParseError, Message: err.Error()})
+		return
+	}
+	if msg.JSONRPC != jsonrpcVersion || msg.Method == "" {
+		if !msg.isNotification() {
+			s.reply(msg.ID, nil, &ResponseError{Code: InvalidRequest, Message: "invalid JSON-RPC request"})
+		}
+		return
+	}
+
+	if msg.isNotification() {
+		s.dispatchNotification(msg)
+	} else {
+		result, err := s.dispatchRequest(msg)
+		s.reply(msg.ID, result, err)
+	}
+}
+
+func (s *Server) dispatchRequest(msg Message) (any, *ResponseError) {
+	fn, exists := s.request_lu[msg.Method]
+	if !exists {
+		return nil, &ResponseError{Code: MethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+	if !s.initialized && msg.Method != "initialize" {
+		return nil, &ResponseError{Code: ServerNotInitialized, Message: "server not initialized"}
+	}
+	if s.shutdown {
+		return nil, &ResponseError{Code: InvalidRequest, Message: "server is shutting down"}
+	}
+
+	result, err := fn(s, msg.Params)
+	if err != nil {
+		if respErr, ok := err.(*ResponseError); ok {
+			return nil, respErr
+		}
+		return nil, &ResponseError{Code: InternalError, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (s *Server) dispatchNotification(msg Message) {
+	fn, exists := s.notification_lu[msg.Method]
+	if !exists {
+		return
+	}
+	if !s.initialized && msg.Method != "exit" {
+		return
+	}
+	if err := fn(s, msg.Params); err != nil {
+		log.Printf("pbls: %s: %s", msg.Method, err)
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, err *ResponseError) {
+	response := Response{
+		JSONRPC: jsonrpcVersion,
+		ID:      id,
+		Result:  result,
+		Error:   err,
+	}
+	if err == nil && result == nil {
+		response.Result = json.RawMessage("null")
+	}
+	s.send(response)
+}
+
+func (s *Server) notify(method string, params any) {
+	s.send(Notification{
+		JSONRPC: jsonrpcVersion,
+		Method:  method,
+		Params:  params,
+	})
+}
+
+func (s *Server) send(msg any) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("pbls: could not encode message: %s", err)
+		return
+	}
+	if err := WriteMessage(s.out, payload); err != nil {
+		log.Printf("pbls: could not write message: %s", err)
+	}
+}
+
+func decodeParams(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
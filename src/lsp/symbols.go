@@ -0,0 +1,148 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"pbls/src/ast"
+	"strings"
+)
+
+func handleDocumentSymbol(s *Server, params json.RawMessage) (any, error) {
+	var symbolParams DocumentSymbolParams
+	if err := decodeParams(params, &symbolParams); err != nil {
+		return nil, err
+	}
+	doc, exists := s.documents[symbolParams.TextDocument.URI]
+	if !exists {
+		return nil, &ResponseError{Code: InvalidParams, Message: fmt.Sprintf("symbols for unknown document %s", symbolParams.TextDocument.URI)}
+	}
+	return documentSymbols(doc, doc.AST.Body), nil
+}
+
+// documentSymbols lists the types, callables and variables declared by body.
+// Functions are listed where they are implemented rather than by their
+// forward prototypes.
+func documentSymbols(doc *document, body []ast.Stmt) []DocumentSymbol {
+	symbols := make([]DocumentSymbol, 0)
+	for _, stmt := range body {
+		switch decl := stmt.(type) {
+		case ast.TypeDecl:
+			symbols = append(symbols, typeSymbol(doc, decl))
+		case ast.FunctionDecl:
+			detail := signature(functionKeyword(decl.IsSubroutine), decl.ReturnType, decl.Name, decl.Params, decl.Throws)
+			symbols = append(symbols, newSymbol(doc, decl.Name, detail, SymbolFunction, decl.Span))
+		case ast.ExternalFunctionDecl:
+			detail := signature(functionKeyword(decl.IsSubroutine), decl.ReturnType, decl.Name, decl.Params, decl.Throws)
+			detail += ` library "` + decl.Library + `"`
+			if decl.Alias != "" {
+				detail += ` alias for "` + decl.Alias + `"`
+			}
+			symbols = append(symbols, newSymbol(doc, decl.Name, detail, SymbolFunction, decl.Span))
+		case ast.EventDecl:
+			symbols = append(symbols, eventSymbol(doc, decl))
+		case ast.PrototypesDecl:
+			if decl.External {
+				symbols = append(symbols, documentSymbols(doc, decl.Body.Body)...)
+			}
+		case ast.VariablesDecl:
+			for _, variable := range decl.Variables {
+				symbols = append(symbols, variableSymbol(doc, variable, SymbolVariable))
+			}
+		case ast.VarDeclStmt:
+			symbols = append(symbols, variableSymbol(doc, decl, SymbolVariable))
+		case ast.MultiVarDeclStmt:
+			for _, variable := range decl.Stmts {
+				symbols = append(symbols, variableSymbol(doc, variable, SymbolVariable))
+			}
+		}
+	}
+	return symbols
+}
+
+func typeSymbol(doc *document, decl ast.TypeDecl) DocumentSymbol {
+	symbol := newSymbol(doc, decl.Name, "from "+typeName(decl.Ancestor), SymbolClass, decl.Span)
+	for _, property := range decl.Properties {
+		symbol.Children = append(symbol.Children, variableSymbol(doc, property, SymbolProperty))
+	}
+	for _, event := range decl.Events {
+		symbol.Children = append(symbol.Children, eventSymbol(doc, event))
+	}
+	return symbol
+}
+func eventSymbol(doc *document, decl ast.EventDecl) DocumentSymbol {
+	return newSymbol(doc, decl.Name, signature("event", decl.ReturnType, decl.Name, decl.Params, decl.Throws), SymbolEvent, decl.Span)
+}
+func variableSymbol(doc *document, decl ast.VarDeclStmt, kind int) DocumentSymbol {
+	return newSymbol(doc, decl.Identifier, typeName(decl.ExplicitType), kind, decl.Span)
+}
+func newSymbol(doc *document, name, detail string, kind int, span ast.Span) DocumentSymbol {
+	return DocumentSymbol{
+		Name:           name,
+		Detail:         detail,
+		Kind:           kind,
+		Range:          toProtocolRange(doc.Lines, span),
+		SelectionRange: toProtocolRange(doc.Lines, span),
+	}
+}
+
+func functionKeyword(isSubroutine bool) string {
+	if isSubroutine {
+		return "subroutine"
+	}
+	return "function"
+}
+
+// signature formats a declaration the way it is written in PowerScript, e.g.
+// `function long of_count(ref string as_names[]) throws Exception`.
+func signature(keyword string, returnType ast.Type, name string, params []ast.Parameter, throws []ast.Type) string {
+	var b strings.Builder
+	b.WriteString(keyword)
+	if returnType != nil {
+		b.WriteString(" " + typeName(returnType))
+	}
+	b.WriteString(" " + name + "(")
+	for i, param := range params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if param.ByRef {
+			b.WriteString("ref ")
+		} else if param.ReadOnly {
+			b.WriteString("readonly ")
+		}
+		if array, ok := param.Type.(ast.ArrayType); ok {
+			b.WriteString(typeName(array.Underlying) + " " + param.Name + "[]")
+		} else {
+			b.WriteString(typeName(param.Type) + " " + param.Name)
+		}
+	}
+	b.WriteString(")")
+	for i, exception := range throws {
+		if i == 0 {
+			b.WriteString(" throws ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(typeName(exception))
+	}
+	return b.String()
+}
+func typeName(t ast.Type) string {
+	switch t := t.(type) {
+	case ast.SymbolType:
+		if t.Precision != nil {
+			return fmt.Sprintf("%s{%d}", t.Name, *t.Precision)
+		}
+		return t.Name
+	case ast.ArrayType:
+		return typeName(t.Underlying) + "[]"
+	}
+	return ""
+}
+
+func toProtocolRange(lines []string, span ast.Span) Range {
+	return Range{
+		Start: toProtocolPosition(lines, span.Start.Line, span.Start.Column),
+		End:   toProtocolPosition(lines, span.End.Line, span.End.Column),
+	}
+}
@@ -0,0 +1,55 @@
+package lsp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const contentLengthHeader = "Content-Length"
+
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	contentLength := -1
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), contentLengthHeader) {
+			contentLength, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || contentLength < 0 {
+				return nil, fmt.Errorf("invalid %s %q", contentLengthHeader, value)
+			}
+		}
+	}
+
+	if contentLength < 0 {
+		return nil, fmt.Errorf("missing %s header", contentLengthHeader)
+	}
+
+	payload := make([]byte, contentLength)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func WriteMessage(w io.Writer, payload []byte) error {
+	if _, err := fmt.Fprintf(w, "%s: %d\r\n\r\n", contentLengthHeader, len(payload)); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
@@ -3,21 +3,42 @@ package main
 import (
 	"fmt"
 	"os"
+	"pbls/src/ast"
+	"pbls/src/diagnostic"
 	"pbls/src/lexer"
+	"pbls/src/lsp"
 	"pbls/src/parser"
 
 	"github.com/sanity-io/litter"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		os.Exit(lsp.NewServer(os.Stdin, os.Stdout).Run())
+	}
+
 	var sourceFilename string = ".\\examples\\07.lang"
+	if len(os.Args) > 1 {
+		sourceFilename = os.Args[1]
+	}
 	content, err := os.ReadFile(sourceFilename)
 	if err != nil {
 		fmt.Printf("Could not read the input file!\n%s", err)
 	}
 	fmt.Printf("Read %d bytes from %s\n", len(content), sourceFilename)
-	tokens := lexer.Tokenize(content)
+	tokens, lexDiagnostics := lexer.Tokenize(content)
 	fmt.Println(litter.Sdump(tokens))
-	ast := parser.Parse(tokens)
-	litter.Dump(ast)
+	var parseDiagnostics []diagnostic.Diagnostic
+	if parser.IsSourceFile(sourceFilename) {
+		var file ast.SourceFile
+		file, parseDiagnostics = parser.ParseSourceFile(tokens)
+		litter.Dump(file)
+	} else {
+		var program ast.BlockStmt
+		program, parseDiagnostics = parser.Parse(tokens)
+		litter.Dump(program)
+	}
+	for _, d := range append(lexDiagnostics, parseDiagnostics...) {
+		fmt.Printf("%s: %s\n", sourceFilename, d.Error())
+	}
 }
@@ -0,0 +1,408 @@
+package parser
+
+import (
+	"pbls/src/ast"
+	"pbls/src/diagnostic"
+	"pbls/src/lexer"
+)
+
+func parse_access_modifier(p *parser) ast.AccessModifier {
+	switch p.currentToken().Kind {
+	case lexer.PUBLIC:
+		p.advance()
+		return ast.PublicAccess
+	case lexer.PROTECTED:
+		p.advance()
+		return ast.ProtectedAccess
+	case lexer.PRIVATE:
+		p.advance()
+		return ast.PrivateAccess
+	}
+	return ast.DefaultAccess
+}
+
+// parse_access_stmt dispatches declarations that start with an access
+// modifier or GLOBAL.
+func parse_access_stmt(p *parser) ast.Stmt {
+	switch p.peek().Kind {
+	case lexer.FUNCTION, lexer.SUBROUTINE:
+		return parse_function_decl(p)
+	}
+	if p.currentToken().Kind == lexer.GLOBAL {
+		switch p.peek().Kind {
+		case lexer.TYPE:
+			return parse_type_decl(p)
+		case lexer.VARIABLES:
+			return parse_variables_decl(p)
+		}
+	}
+	return parse_var_decl_stmt(p)
+}
+
+func parse_function_decl(p *parser) ast.Stmt {
+	start := startOf(p.currentToken())
+	decl := ast.FunctionDecl{}
+	if p.currentToken().Kind == lexer.GLOBAL {
+		p.advance()
+		decl.Global = true
+	} else {
+		decl.Access = parse_access_modifier(p)
+	}
+
+	if p.expectOneOf(lexer.FUNCTION, lexer.SUBROUTINE).Kind == lexer.SUBROUTINE {
+		decl.IsSubroutine = true
+	} else {
+		decl.ReturnType = parse_type(p, default_bp)
+	}
+	decl.Name = p.expectName().Value
+	decl.Params = parse_parameter_list(p)
+	decl.Throws = parse_throws_clause(p)
+	decl.Span = p.spanFrom(start)
+	if p.currentToken().Kind == lexer.LIBRARY {
+		return parse_external_function_decl(p, decl)
+	}
+
+	keyword := lexer.FUNCTION
+	if decl.IsSubroutine {
+		keyword = lexer.SUBROUTINE
+	}
+	body, closed := parse_script_body(p, keyword)
+	decl.Body = body
+	if decl.Body != nil {
+		decl.Span = p.spanFrom(start)
+	}
+	if closed {
+		p.expectEndOfStatement()
+	}
+	return decl
+}
+
+// parse_external_function_decl parses the `LIBRARY "name" [ALIAS FOR "name"]`
+// following the signature of an external function.
+func parse_external_function_decl(p *parser, signature ast.FunctionDecl) ast.Stmt {
+	p.expect(lexer.LIBRARY)
+	decl := ast.ExternalFunctionDecl{
+		Access:       signature.Access,
+		Global:       signature.Global,
+		IsSubroutine: signature.IsSubroutine,
+		ReturnType:   signature.ReturnType,
+		Name:         signature.Name,
+		Params:       signature.Params,
+		Throws:       signature.Throws,
+		Library:      lexer.UnescapeString(p.expect(lexer.STRING).Value),
+	}
+	if p.currentToken().Kind == lexer.ALIAS {
+		p.advance()
+		p.expect(lexer.FOR)
+		decl.Alias = lexer.UnescapeString(p.expect(lexer.STRING).Value)
+	}
+	decl.Span = p.spanFrom(signature.Start)
+	p.expectEndOfStatement()
+	return decl
+}
+
+func parse_event_decl(p *parser) ast.Stmt {
+	if isEventCall(p) {
+		return parse_expression_stmt(p)
+	}
+	start := startOf(p.expect(lexer.EVENT))
+	decl := ast.EventDecl{
+		Params: make([]ast.Parameter, 0),
+		Throws: make([]ast.Type, 0),
+	}
+
+	if p.currentToken().Kind == lexer.TYPE {
+		p.advance()
+		decl.ReturnType = parse_type(p, default_bp)
+	}
+	decl.Name = p.expectName().Value
+	if p.currentToken().Kind == lexer.IDENTIFIER {
+		decl.EventID = p.advance().Value
+	} else if p.currentToken().Kind == lexer.OPEN_PAREN {
+		decl.Params = parse_parameter_list(p)
+	}
+	decl.Throws = parse_throws_clause(p)
+	decl.Span = p.spanFrom(start)
+
+	body, closed := parse_script_body(p, lexer.EVENT)
+	decl.Body = body
+	if decl.Body != nil {
+		decl.Span = p.spanFrom(start)
+	}
+	if closed {
+		p.expectEndOfStatement()
+	}
+	return decl
+}
+
+// isEventCall tells `event ue_load(1)`, which calls an event, from the
+// declaration `event ue_load(long al_id)`. Inside a script it is always a call.
+func isEventCall(p *parser) bool {
+	if p.scriptDepth > 0 {
+		return true
+	}
+	switch p.lookahead(1).Kind {
+	case lexer.POST, lexer.TRIGGER, lexer.STATIC, lexer.DYNAMIC:
+		return true
+	}
+	if p.lookahead(2).Kind != lexer.OPEN_PAREN {
+		return false
+	}
+	// The first parameter of a declaration starts with a type and a name.
+	first, second := p.lookahead(3), p.lookahead(4)
+	switch first.Kind {
+	case lexer.CLOSE_PAREN, lexer.REF, lexer.READONLY:
+		return false
+	case lexer.IDENTIFIER_TYPE:
+		return second.Kind == lexer.OPEN_PAREN
+	case lexer.IDENTIFIER:
+		return second.Kind != lexer.IDENTIFIER
+	}
+	return true
+}
+
+// parse_script_body parses the statements of a function or event up to the
+// closing `END <keyword>`. A signature ended by a new line instead of a
+// semicolon is a prototype and has no body. The result reports whether the
+// body was closed.
+func parse_script_body(p *parser, keyword lexer.TokenKind) (*ast.BlockStmt, bool) {
+	if p.currentToken().Kind != lexer.SEMICOLON {
+		return nil, true
+	}
+	p.advance()
+
+	p.scriptDepth++
+	defer func() { p.scriptDepth-- }()
+	body := parse_block(p, lexer.END)
+	closed := p.expectBlockEnd(keyword)
+	return &body, closed
+}
+
+func parse_parameter_list(p *parser) []ast.Parameter {
+	params := make([]ast.Parameter, 0)
+	p.expect(lexer.OPEN_PAREN)
+	if p.currentToken().Kind != lexer.CLOSE_PAREN {
+		params = append(params, parse_parameter(p))
+		for p.currentToken().Kind == lexer.COMMA {
+			p.advance()
+			params = append(params, parse_parameter(p))
+		}
+	}
+	p.expect(lexer.CLOSE_PAREN)
+	return params
+}
+
+func parse_parameter(p *parser) ast.Parameter {
+	start := startOf(p.currentToken())
+	param := ast.Parameter{}
+
+	switch p.currentToken().Kind {
+	case lexer.REF:
+		p.advance()
+		param.ByRef = true
+	case lexer.READONLY:
+		p.advance()
+		param.ReadOnly = true
+	}
+	param.Type = parse_type(p, default_bp)
+	param.Name = p.expect(lexer.IDENTIFIER).Value
+
+	if p.currentToken().Kind == lexer.OPEN_BRACKET {
+		param.Type = parse_array_type(p, param.Type, default_bp)
+	}
+	param.Span = p.spanFrom(start)
+	return param
+}
+
+func parse_forward_decl(p *parser) ast.Stmt {
+	if p.peek().Kind == lexer.PROTOTYPES {
+		return parse_prototypes_decl(p)
+	}
+	start := startOf(p.expect(lexer.FORWARD))
+	p.expectEndOfStatement()
+	decl := ast.ForwardDecl{Body: parse_block(p, lexer.END)}
+	closed := p.expectBlockEnd(lexer.FORWARD)
+	decl.Span = p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+	return decl
+}
+
+func parse_prototypes_decl(p *parser) ast.Stmt {
+	start := startOf(p.currentToken())
+	external := p.expectOneOf(lexer.FORWARD, lexer.TYPE).Kind == lexer.TYPE
+	p.expect(lexer.PROTOTYPES)
+	p.expectEndOfStatement()
+
+	decl := ast.PrototypesDecl{
+		External: external,
+		Body:     parse_block(p, lexer.END),
+	}
+	closed := p.expectBlockEnd(lexer.PROTOTYPES)
+	decl.Span = p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+	return decl
+}
+
+func parse_type_decl(p *parser) ast.Stmt {
+	if p.currentToken().Kind == lexer.TYPE {
+		switch p.peek().Kind {
+		case lexer.VARIABLES:
+			return parse_variables_decl(p)
+		case lexer.PROTOTYPES:
+			return parse_prototypes_decl(p)
+		}
+	}
+
+	start := startOf(p.currentToken())
+	decl := ast.TypeDecl{
+		Descriptors: make([]ast.DescriptorDecl, 0),
+		Properties:  make([]ast.VarDeclStmt, 0),
+		Events:      make([]ast.EventDecl, 0),
+	}
+	if p.currentToken().Kind == lexer.GLOBAL {
+		p.advance()
+		decl.Global = true
+	}
+	p.expect(lexer.TYPE)
+	decl.Name = p.expectName().Value
+	p.expect(lexer.FROM)
+	decl.Ancestor = parse_type(p, default_bp)
+	if p.currentToken().Kind == lexer.WITHIN {
+		p.advance()
+		decl.Within = parse_type(p, default_bp)
+	}
+	if p.currentToken().Kind == lexer.AUTOINSTANTIATE {
+		p.advance()
+		decl.AutoInstantiate = true
+	}
+	p.expectEndOfStatement()
+
+	parse_type_members(p, &decl)
+	closed := p.expectBlockEnd(lexer.TYPE)
+	decl.Span = p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+	return decl
+}
+
+// parse_type_members sorts the lines of a type body into its descriptors,
+// properties and events.
+func parse_type_members(p *parser, decl *ast.TypeDecl) {
+	for p.skipEmptyStatements(); p.hasTokens() && p.currentToken().Kind != lexer.END; p.skipEmptyStatements() {
+		first := p.currentToken()
+		switch member := parse_stmt_with_recovery(p).(type) {
+		case ast.DescriptorDecl:
+			decl.Descriptors = append(decl.Descriptors, member)
+		case ast.VarDeclStmt:
+			member.Scope = ast.InstanceScope
+			decl.Properties = append(decl.Properties, member)
+		case ast.MultiVarDeclStmt:
+			for _, property := range member.Stmts {
+				property.Scope = ast.InstanceScope
+				decl.Properties = append(decl.Properties, property)
+			}
+		case ast.EventDecl:
+			decl.Events = append(decl.Events, member)
+		case ast.BadStmt:
+		default:
+			p.report(diagnostic.UnexpectedToken, first, "Expected a property, descriptor or event in type '%s'", decl.Name)
+		}
+	}
+}
+
+func parse_descriptor_decl(p *parser) ast.Stmt {
+	start := startOf(p.expect(lexer.DESCRIPTOR))
+	name := lexer.UnescapeString(p.expect(lexer.STRING).Value)
+	p.expect(lexer.EQUALS)
+	value := lexer.UnescapeString(p.expect(lexer.STRING).Value)
+	decl := ast.DescriptorDecl{
+		Span:  p.spanFrom(start),
+		Name:  name,
+		Value: value,
+	}
+	p.expectEndOfStatement()
+	return decl
+}
+
+func parse_variables_decl(p *parser) ast.Stmt {
+	start := startOf(p.currentToken())
+	decl := ast.VariablesDecl{Variables: make([]ast.VarDeclStmt, 0)}
+	switch p.expectOneOf(lexer.TYPE, lexer.SHARED, lexer.GLOBAL).Kind {
+	case lexer.TYPE:
+		decl.Scope = ast.InstanceScope
+	case lexer.SHARED:
+		decl.Scope = ast.SharedScope
+	case lexer.GLOBAL:
+		decl.Scope = ast.GlobalScope
+	}
+	p.expect(lexer.VARIABLES)
+	p.expectEndOfStatement()
+
+	parse_variables_members(p, &decl)
+	closed := p.expectBlockEnd(lexer.VARIABLES)
+	decl.Span = p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+	return decl
+}
+
+// parse_variables_members parses the declarations of a variables section. A
+// `public:`, `protected:` or `private:` label sets the access of the
+// declarations after it that do not name their own.
+func parse_variables_members(p *parser, decl *ast.VariablesDecl) {
+	access := ast.DefaultAccess
+	for p.skipEmptyStatements(); p.hasTokens() && p.currentToken().Kind != lexer.END; p.skipEmptyStatements() {
+		first := p.currentToken()
+		if first.IsOneOfMany(lexer.PUBLIC, lexer.PROTECTED, lexer.PRIVATE) && p.peek().Kind == lexer.COLON {
+			access = parse_access_modifier(p)
+			p.advance()
+			continue
+		}
+
+		var variables []ast.VarDeclStmt
+		switch member := parse_stmt_with_recovery(p).(type) {
+		case ast.VarDeclStmt:
+			variables = []ast.VarDeclStmt{member}
+		case ast.MultiVarDeclStmt:
+			variables = member.Stmts
+		case ast.BadStmt:
+		default:
+			p.report(diagnostic.UnexpectedToken, first, "Expected a variable declaration in a variables section")
+		}
+		for _, variable := range variables {
+			variable.Scope = decl.Scope
+			if variable.Access == ast.DefaultAccess {
+				variable.Access = access
+			}
+			decl.Variables = append(decl.Variables, variable)
+		}
+	}
+}
+
+func parse_on_decl(p *parser) ast.Stmt {
+	start := startOf(p.expect(lexer.ON))
+	decl := ast.OnDecl{}
+	decl.Event = p.expectName().Value
+	if p.currentToken().Kind == lexer.DOT {
+		p.advance()
+		decl.Object = decl.Event
+		decl.Event = p.expectName().Value
+	}
+	p.expectEndOfStatement()
+
+	p.scriptDepth++
+	defer func() { p.scriptDepth-- }()
+	decl.Body = parse_block(p, lexer.END)
+	closed := p.expectBlockEnd(lexer.ON)
+	decl.Span = p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+	return decl
+}
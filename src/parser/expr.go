@@ -1,25 +1,56 @@
 package parser
 
 import (
-	"fmt"
 	"pbls/src/ast"
+	"pbls/src/diagnostic"
 	"pbls/src/lexer"
 	"strconv"
+	"strings"
 )
 
+// expr_terminators_lu holds the tokens that end or continue the construct
+// around an expression. A missing expression in front of them is reported
+// without consuming the token.
+var expr_terminators_lu = map[lexer.TokenKind]bool{
+	lexer.THEN:  true,
+	lexer.TO:    true,
+	lexer.STEP:  true,
+	lexer.COMMA: true,
+}
+
+// atEndOfExpr reports whether the current token ends the construct around an
+// expression. Closing brackets only do so inside a pair of brackets.
+func (p *parser) atEndOfExpr() bool {
+	if p.currentToken().IsOneOfMany(lexer.CLOSE_PAREN, lexer.CLOSE_BRACKET, lexer.CLOSE_CURLY) {
+		return p.groupDepth > 0
+	}
+	return expr_terminators_lu[p.currentToken().Kind] || p.atEndOfStatement()
+}
+
 func parse_expr(p *parser, bp BindingPower) ast.Expr {
 	tokenKind := p.currentToken().Kind
 	nud_fn, exists := nud_lu[tokenKind]
 	if !exists {
-		panic(fmt.Sprintf("1-NUD HANDLER EXPECTED FOR TOKEN %s\n", lexer.TokenKindString(tokenKind)))
+		badToken := p.currentToken()
+		p.report(diagnostic.ExpectedExpr, badToken, "Expected an expression but got '%s'", lexer.TokenKindString(tokenKind))
+		if p.atEndOfExpr() {
+			return ast.BadExpr{Span: ast.Span{Start: startOf(badToken), End: startOf(badToken)}}
+		}
+		p.advance()
+		return ast.BadExpr{Span: tokenSpan(badToken)}
 	}
 
-	left := nud_fn(p)
+	return parse_expr_from(p, nud_fn(p), bp)
+}
+
+// parse_expr_from continues an expression whose left-hand side has already
+// been parsed.
+func parse_expr_from(p *parser, left ast.Expr, bp BindingPower) ast.Expr {
 	for bp_lu[p.currentToken().Kind] > bp {
 		tokenKind := p.currentToken().Kind
 		led_fn, exists := led_lu[tokenKind]
 		if !exists {
-			panic(fmt.Sprintf("2-LED HANDLER EXPECTED FOR TOKEN %s\n", lexer.TokenKindString(tokenKind)))
+			p.error(diagnostic.UnexpectedToken, p.currentToken(), "Unexpected '%s' in expression", lexer.TokenKindString(tokenKind))
 		}
 		left = led_fn(p, left, bp_lu[p.currentToken().Kind])
 	}
@@ -31,59 +62,220 @@ func parse_binary_expr(p *parser, left ast.Expr, bp BindingPower) ast.Expr {
 	operatorToken := p.advance()
 	right := parse_expr(p, bp)
 	return ast.BinaryExpr{
+		Span:     ast.Span{Start: left.Range().Start, End: right.Range().End},
 		Left:     left,
 		Operator: operatorToken,
 		Right:    right,
 	}
 }
 func parse_primary_expr(p *parser) ast.Expr {
-	switch p.currentToken().Kind {
+	tkn := p.currentToken()
+	switch tkn.Kind {
 	case lexer.NUMBER:
 		number, _ := strconv.ParseFloat(p.advance().Value, 64)
 		return ast.NumberExpr{
+			Span:  tokenSpan(tkn),
 			Value: number,
 		}
 	case lexer.STRING:
+		raw := p.advance().Value
 		return ast.StringExpr{
-			Value: p.advance().Value,
+			Span:  tokenSpan(tkn),
+			Value: lexer.UnescapeString(raw),
+			Raw:   raw,
+		}
+	case lexer.TRUE, lexer.FALSE:
+		return ast.BooleanExpr{
+			Span:  tokenSpan(tkn),
+			Value: p.advance().Kind == lexer.TRUE,
 		}
-	case lexer.IDENTIFIER:
+	case lexer.IDENTIFIER, lexer.IDENTIFIER_TYPE, lexer.THIS, lexer.PARENT, lexer.SUPER, lexer.OPEN, lexer.CLOSE:
 		return ast.SymbolExpr{
+			Span:  tokenSpan(tkn),
 			Value: p.advance().Value,
 		}
+	case lexer.ENUM_VALUE:
+		return ast.EnumExpr{
+			Span:  tokenSpan(tkn),
+			Value: strings.TrimSuffix(p.advance().Value, "!"),
+		}
 	default:
-		panic(fmt.Sprintf("Cannot create primary_expression from %s\n", lexer.TokenKindString(p.currentToken().Kind)))
-	}
-}
-func parse_assignment_expr(p *parser, left ast.Expr, bp BindingPower) ast.Expr {
-	operator := p.advance()
-	rhs := parse_expr(p, bp)
-	return ast.AssignmentExpr{
-		Assigne:  left,
-		Operator: operator,
-		Value:    rhs,
+		p.error(diagnostic.ExpectedExpr, p.currentToken(), "Cannot create primary_expression from %s", lexer.TokenKindString(p.currentToken().Kind))
+		return nil
 	}
 }
+
+// parse_prefix_expr parses a sign or NOT. NOT applies to a whole comparison,
+// `not a = b` is `not (a = b)`, while a sign only binds to its operand.
 func parse_prefix_expr(p *parser) ast.Expr {
 	operatorToken := p.advance()
-	rhs := parse_expr(p, default_bp)
+	bp := unary
+	if operatorToken.Kind == lexer.NOT {
+		bp = logical_not
+	}
+	rhs := parse_expr(p, bp)
 
 	return ast.PrefixExpr{
+		Span:     ast.Span{Start: startOf(operatorToken), End: rhs.Range().End},
 		Operator: operatorToken,
 		Value:    rhs,
 	}
 }
+func parse_postfix_expr(p *parser, left ast.Expr, bp BindingPower) ast.Expr {
+	operatorToken := p.advance()
+	return ast.PostfixExpr{
+		Span:     ast.Span{Start: left.Range().Start, End: endOf(operatorToken)},
+		Operator: operatorToken,
+		Value:    left,
+	}
+}
 func parse_grouping_expr(p *parser) ast.Expr {
-	p.advance()
+	start := startOf(p.advance())
+	p.groupDepth++
+	defer func() { p.groupDepth-- }()
 	expr := parse_expr(p, default_bp)
 	p.expect(lexer.CLOSE_PAREN)
-	return expr
+	return ast.GroupingExpr{
+		Span:  p.spanFrom(start),
+		Value: expr,
+	}
+}
+
+func parse_call_expr(p *parser, left ast.Expr, bp BindingPower) ast.Expr {
+	p.advance()
+	arguments := parse_expr_list(p, lexer.CLOSE_PAREN)
+	p.expect(lexer.CLOSE_PAREN)
+
+	return ast.CallExpr{
+		Span:      p.spanFrom(left.Range().Start),
+		Method:    left,
+		Arguments: arguments,
+	}
+}
+func parse_member_expr(p *parser, left ast.Expr, bp BindingPower) ast.Expr {
+	p.advance()
+	if isInvocationQualifier(p) {
+		return parse_invocation(p, left, "", left.Range().Start)
+	}
+	property := p.expectName()
+
+	return ast.MemberExpr{
+		Span:     p.spanFrom(left.Range().Start),
+		Member:   left,
+		Property: property.Value,
+	}
+}
+
+// parse_ancestor_call_expr parses the call of an ancestor's function or event,
+// `super::of_init()` or `u_base::event ue_load()`.
+func parse_ancestor_call_expr(p *parser, left ast.Expr, bp BindingPower) ast.Expr {
+	colons := p.expect(lexer.COLON_COLON)
+	ancestor, ok := left.(ast.SymbolExpr)
+	if !ok {
+		p.error(diagnostic.UnexpectedToken, colons, "Expected the name of an ancestor in front of '::'")
+	}
+	return parse_invocation(p, nil, ancestor.Value, left.Range().Start)
+}
+func parse_invocation_expr(p *parser) ast.Expr {
+	return parse_invocation(p, nil, "", startOf(p.currentToken()))
+}
+
+// parse_invocation parses
+// `[POST | TRIGGER] [STATIC | DYNAMIC] [FUNCTION | EVENT] name(arguments)`
+// called on object, which is nil for calls without one.
+func parse_invocation(p *parser, object ast.Expr, ancestor string, start ast.Position) ast.Expr {
+	call := ast.CallExpr{Ancestor: ancestor}
+qualifiers:
+	for {
+		switch p.currentToken().Kind {
+		case lexer.POST:
+			call.IsPost = true
+		case lexer.DYNAMIC:
+			call.IsDynamic = true
+		case lexer.EVENT:
+			call.IsEvent = true
+		case lexer.TRIGGER, lexer.STATIC, lexer.FUNCTION:
+		default:
+			break qualifiers
+		}
+		call.Qualifiers = append(call.Qualifiers, p.advance())
+	}
+
+	name := p.expectName()
+	if object == nil {
+		call.Method = ast.SymbolExpr{Span: tokenSpan(name), Value: name.Value}
+	} else {
+		call.Method = ast.MemberExpr{Span: p.spanFrom(start), Member: object, Property: name.Value}
+	}
+	p.expect(lexer.OPEN_PAREN)
+	call.Arguments = parse_expr_list(p, lexer.CLOSE_PAREN)
+	p.expect(lexer.CLOSE_PAREN)
+	call.Span = p.spanFrom(start)
+	return call
 }
 
-func parse_newline(p *parser) ast.Expr {
+// isInvocationQualifier reports whether the current token starts the
+// qualifiers of a call such as `post event ue_load()` rather than being the
+// name of a member.
+func isInvocationQualifier(p *parser) bool {
+	if !p.currentToken().IsOneOfMany(lexer.POST, lexer.TRIGGER, lexer.STATIC, lexer.DYNAMIC, lexer.FUNCTION, lexer.EVENT) {
+		return false
+	}
+	next := p.peek().Kind
+	return next == lexer.IDENTIFIER || next == lexer.IDENTIFIER_TYPE || lexer.IsKeyword(next)
+}
+
+func parse_index_expr(p *parser, left ast.Expr, bp BindingPower) ast.Expr {
 	p.advance()
-	return nil
+	indexes := parse_expr_list(p, lexer.CLOSE_BRACKET)
+	p.expect(lexer.CLOSE_BRACKET)
+
+	return ast.IndexExpr{
+		Span:    p.spanFrom(left.Range().Start),
+		Member:  left,
+		Indexes: indexes,
+	}
+}
+
+// parse_expr_list parses comma separated expressions up to, but not
+// including, the closing token.
+func parse_expr_list(p *parser, closing lexer.TokenKind) []ast.Expr {
+	p.groupDepth++
+	defer func() { p.groupDepth-- }()
+	exprs := make([]ast.Expr, 0)
+	if p.currentToken().Kind == closing {
+		return exprs
+	}
+	exprs = append(exprs, parse_expr(p, default_bp))
+	for p.currentToken().Kind == lexer.COMMA {
+		p.advance()
+		exprs = append(exprs, parse_expr(p, default_bp))
+	}
+	return exprs
 }
 
-// TODO: ComputedExpression => array[index] | array[expr]
-// TODO: XX => const foo = [1, 2, 3]
+func parse_array_literal_expr(p *parser) ast.Expr {
+	start := startOf(p.expect(lexer.OPEN_CURLY))
+	elements := parse_expr_list(p, lexer.CLOSE_CURLY)
+	p.expect(lexer.CLOSE_CURLY)
+	return ast.ArrayLiteralExpr{
+		Span:     p.spanFrom(start),
+		Elements: elements,
+	}
+}
+
+func parse_create_expr(p *parser) ast.Expr {
+	start := startOf(p.expect(lexer.CREATE))
+	if p.currentToken().Kind == lexer.USING {
+		p.advance()
+		using := parse_expr(p, default_bp)
+		return ast.CreateExpr{
+			Span:  p.spanFrom(start),
+			Using: using,
+		}
+	}
+	return ast.CreateExpr{
+		Span: p.spanFrom(start),
+		Type: parse_type(p, default_bp),
+	}
+}
@@ -10,11 +10,13 @@ type BindingPower int
 const (
 	default_bp BindingPower = iota
 	comma
-	assignment
-	logical
+	logical_or
+	logical_and
+	logical_not
 	relational
 	additive
 	multiplicative
+	exponent
 	unary
 	call
 	member
@@ -35,6 +37,18 @@ var nud_lu = nud_lookup{}
 var led_lu = led_lookup{}
 var stmt_lu = stmt_lookup{}
 
+// assignment_lu holds the operators of an AssignStmt. They are statements in
+// PowerScript, so none of them continues an expression.
+var assignment_lu = map[lexer.TokenKind]bool{
+	lexer.EQUALS:         true,
+	lexer.PLUS_EQUALS:    true,
+	lexer.MINUS_EQUALS:   true,
+	lexer.SLASH_EQUALS:   true,
+	lexer.STAR_EQUALS:    true,
+	lexer.PERCENT_EQUALS: true,
+	lexer.CARET_EQUALS:   true,
+}
+
 func led(kind lexer.TokenKind, bp BindingPower, led_fn led_handler) {
 	bp_lu[kind] = bp
 	led_lu[kind] = led_fn
@@ -47,17 +61,9 @@ func stmt(kind lexer.TokenKind, stmt_fn stmt_handler) {
 	stmt_lu[kind] = stmt_fn
 }
 func createTokenLookups() {
-	// Assignment
-	led(lexer.EQUALS, assignment, parse_assignment_expr)
-	led(lexer.PLUS_EQUALS, assignment, parse_assignment_expr)
-	led(lexer.MINUS_EQUALS, assignment, parse_assignment_expr)
-	led(lexer.SLASH_EQUALS, assignment, parse_assignment_expr)
-	led(lexer.STAR_EQUALS, assignment, parse_assignment_expr)
-	led(lexer.PERCENT_EQUALS, assignment, parse_assignment_expr)
-
 	// Logical
-	led(lexer.AND, logical, parse_binary_expr)
-	led(lexer.OR, logical, parse_binary_expr)
+	led(lexer.OR, logical_or, parse_binary_expr)
+	led(lexer.AND, logical_and, parse_binary_expr)
 
 	// Relational
 	led(lexer.LESS, relational, parse_binary_expr)
@@ -76,16 +82,75 @@ func createTokenLookups() {
 	led(lexer.SLASH, multiplicative, parse_binary_expr)
 	led(lexer.PERCENT, multiplicative, parse_binary_expr)
 
+	// Exponent
+	led(lexer.CARET, exponent, parse_binary_expr)
+
+	// Postfix
+	led(lexer.PLUS_PLUS, unary, parse_postfix_expr)
+	led(lexer.MINUS_MINUS, unary, parse_postfix_expr)
+
+	// Call, Member & Index
+	led(lexer.OPEN_PAREN, call, parse_call_expr)
+	led(lexer.OPEN_BRACKET, call, parse_index_expr)
+	led(lexer.DOT, member, parse_member_expr)
+	led(lexer.COLON_COLON, member, parse_ancestor_call_expr)
+
 	// Literals & Symbols
 	nud(lexer.NUMBER, parse_primary_expr)
 	nud(lexer.STRING, parse_primary_expr)
+	nud(lexer.TRUE, parse_primary_expr)
+	nud(lexer.FALSE, parse_primary_expr)
 	nud(lexer.IDENTIFIER, parse_primary_expr)
+	nud(lexer.IDENTIFIER_TYPE, parse_primary_expr)
+	nud(lexer.THIS, parse_primary_expr)
+	nud(lexer.PARENT, parse_primary_expr)
+	nud(lexer.SUPER, parse_primary_expr)
+	nud(lexer.OPEN, parse_primary_expr)
+	nud(lexer.CLOSE, parse_primary_expr)
+	nud(lexer.ENUM_VALUE, parse_primary_expr)
+	nud(lexer.CREATE, parse_create_expr)
+	nud(lexer.EVENT, parse_invocation_expr)
+	nud(lexer.POST, parse_invocation_expr)
+	nud(lexer.TRIGGER, parse_invocation_expr)
+	nud(lexer.DYNAMIC, parse_invocation_expr)
 	nud(lexer.MINUS, parse_prefix_expr)
+	nud(lexer.PLUS, parse_prefix_expr)
+	nud(lexer.NOT, parse_prefix_expr)
 	nud(lexer.OPEN_PAREN, parse_grouping_expr)
+	nud(lexer.OPEN_CURLY, parse_array_literal_expr)
 
 	// Statements
 	stmt(lexer.CONSTANT, parse_var_decl_stmt)
 	stmt(lexer.IDENTIFIER_TYPE, parse_var_decl_stmt)
+	stmt(lexer.IF, parse_if_stmt)
+	stmt(lexer.CHOOSE, parse_choose_case_stmt)
+	stmt(lexer.FOR, parse_for_stmt)
+	stmt(lexer.DO, parse_do_loop_stmt)
+	stmt(lexer.TRY, parse_try_stmt)
+	stmt(lexer.THROW, parse_throw_stmt)
+	stmt(lexer.RETURN, parse_return_stmt)
+	stmt(lexer.EXIT, parse_exit_stmt)
+	stmt(lexer.CONTINUE, parse_continue_stmt)
+	stmt(lexer.HALT, parse_halt_stmt)
+	stmt(lexer.GOTO, parse_goto_stmt)
+	stmt(lexer.DESTROY, parse_destroy_stmt)
+	stmt(lexer.CALL, parse_call_stmt)
 
-	nud(lexer.NEWLINE, parse_newline)
+	// Declarations
+	stmt(lexer.FUNCTION, parse_function_decl)
+	stmt(lexer.SUBROUTINE, parse_function_decl)
+	stmt(lexer.EVENT, parse_event_decl)
+	stmt(lexer.PUBLIC, parse_access_stmt)
+	stmt(lexer.PROTECTED, parse_access_stmt)
+	stmt(lexer.PRIVATE, parse_access_stmt)
+	stmt(lexer.GLOBAL, parse_access_stmt)
+	stmt(lexer.PROTECTEDREAD, parse_var_decl_stmt)
+	stmt(lexer.PROTECTEDWRITE, parse_var_decl_stmt)
+	stmt(lexer.PRIVATEREAD, parse_var_decl_stmt)
+	stmt(lexer.PRIVATEWRITE, parse_var_decl_stmt)
+	stmt(lexer.FORWARD, parse_forward_decl)
+	stmt(lexer.TYPE, parse_type_decl)
+	stmt(lexer.DESCRIPTOR, parse_descriptor_decl)
+	stmt(lexer.SHARED, parse_variables_decl)
+	stmt(lexer.ON, parse_on_decl)
 }
@@ -2,13 +2,21 @@ package parser
 
 import (
 	"fmt"
+	"path/filepath"
 	"pbls/src/ast"
+	"pbls/src/diagnostic"
 	"pbls/src/lexer"
+	"strings"
 )
 
 type parser struct {
-	tokens  []lexer.Token
-	current int
+	tokens       []lexer.Token
+	current      int
+	diagnostics  []diagnostic.Diagnostic
+	singleLineIf int
+	scriptDepth  int
+	groupDepth   int
+	stmtErrors   int
 }
 
 func NewParser(tokens []lexer.Token) *parser {
@@ -19,20 +27,94 @@ func NewParser(tokens []lexer.Token) *parser {
 	}
 }
 
-func Parse(tokens []lexer.Token) ast.BlockStmt {
-	body := make([]ast.Stmt, 0)
+func Parse(tokens []lexer.Token) (ast.BlockStmt, []diagnostic.Diagnostic) {
 	parser := NewParser(tokens)
-
-	for parser.hasTokens() {
-		body = append(body, parse_stmt(parser))
-	}
+	body := parse_statements(parser)
 
 	return ast.BlockStmt{
+		Span: ast.Span{Start: startOf(tokens[0]), End: endOf(tokens[len(tokens)-1])},
 		Body: body,
+	}, parser.diagnostics
+}
+
+// ParseSourceFile parses an object exported from a PowerBuilder library. The
+// `$PBExportHeader$` and `$PBExportComments$` lines are optional.
+func ParseSourceFile(tokens []lexer.Token) (ast.SourceFile, []diagnostic.Diagnostic) {
+	parser := NewParser(tokens)
+	file := ast.SourceFile{
+		Span: ast.Span{Start: startOf(tokens[0]), End: endOf(tokens[len(tokens)-1])},
+	}
+
+	parser.skipEmptyStatements()
+	if parser.currentToken().Kind == lexer.EXPORT_HEADER {
+		file.Header = strings.TrimPrefix(parser.advance().Value, "$PBExportHeader$")
+		parser.skipEmptyStatements()
+	}
+	if parser.currentToken().Kind == lexer.EXPORT_COMMENTS {
+		file.Comments = strings.TrimPrefix(parser.advance().Value, "$PBExportComments$")
+	}
+	file.Body = parse_statements(parser)
+
+	return file, parser.diagnostics
+}
+
+var source_file_extensions_lu = map[string]bool{
+	".sra": true,
+	".srf": true,
+	".srm": true,
+	".srs": true,
+	".sru": true,
+	".srw": true,
+}
+
+// IsSourceFile reports whether name, a path or URI, refers to an exported
+// object that should be parsed with ParseSourceFile.
+func IsSourceFile(name string) bool {
+	return source_file_extensions_lu[strings.ToLower(filepath.Ext(name))]
+}
+
+func parse_statements(p *parser) []ast.Stmt {
+	body := make([]ast.Stmt, 0)
+	for p.skipEmptyStatements(); p.hasTokens(); p.skipEmptyStatements() {
+		body = append(body, parse_stmt_with_recovery(p))
 	}
+	return body
+}
+
+func startOf(tkn lexer.Token) ast.Position {
+	return ast.Position{Line: tkn.Line, Column: tkn.Column, Offset: tkn.Offset}
+}
+func endOf(tkn lexer.Token) ast.Position {
+	return ast.Position{Line: tkn.Line, Column: tkn.Column + tkn.Length(), Offset: tkn.Offset + tkn.Length()}
+}
+func tokenSpan(tkn lexer.Token) ast.Span {
+	return ast.Span{Start: startOf(tkn), End: endOf(tkn)}
+}
+
+// spanFrom returns the span from start up to the end of the last consumed token.
+func (p *parser) spanFrom(start ast.Position) ast.Span {
+	return ast.Span{Start: start, End: endOf(p.previousToken())}
+}
+
+// report records a diagnostic located at token and lets parsing continue.
+func (p *parser) report(code diagnostic.Code, token lexer.Token, format string, args ...any) {
+	p.diagnostics = append(p.diagnostics, newDiagnostic(code, token, format, args...))
+	p.stmtErrors++
+}
+
+// error aborts the current statement with a diagnostic located at token.
+// The statement is recovered from in parse_stmt_with_recovery.
+func (p *parser) error(code diagnostic.Code, token lexer.Token, format string, args ...any) {
+	panic(newDiagnostic(code, token, format, args...))
+}
+func newDiagnostic(code diagnostic.Code, token lexer.Token, format string, args ...any) diagnostic.Diagnostic {
+	return diagnostic.New(code, diagnostic.Error, token.Line, token.Column, token.Length(), fmt.Sprintf(format, args...))
 }
 
 func (p *parser) currentToken() lexer.Token {
+	if p.current >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
 	return p.tokens[p.current]
 }
 func (p *parser) advance() lexer.Token {
@@ -40,23 +122,98 @@ func (p *parser) advance() lexer.Token {
 	p.current++
 	return tkn
 }
+func (p *parser) previousToken() lexer.Token {
+	return p.tokens[max(min(p.current, len(p.tokens))-1, 0)]
+}
 func (p *parser) peek() lexer.Token {
-	tkn := p.tokens[p.current+2]
-	return tkn
+	return p.lookahead(1)
+}
+func (p *parser) lookahead(offset int) lexer.Token {
+	if p.current+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.current+offset]
 }
 func (p *parser) hasTokens() bool {
 	return p.current < len(p.tokens) && p.currentToken().Kind != lexer.EOF
 }
+func (p *parser) atEndOfStatement() bool {
+	kind := p.currentToken().Kind
+	if p.singleLineIf > 0 && kind == lexer.ELSE {
+		return true
+	}
+	return kind == lexer.NEWLINE || kind == lexer.SEMICOLON || kind == lexer.EOF
+}
+func (p *parser) expectEndOfStatement() {
+	kind := p.currentToken().Kind
+	// The statement after THEN of a single-line IF may be ended by its ELSE.
+	if kind == lexer.EOF || (p.singleLineIf > 0 && kind == lexer.ELSE) {
+		return
+	}
+	p.expectOneOf(lexer.NEWLINE, lexer.SEMICOLON)
+}
+
+// expectClosing consumes the keyword closing a block, such as NEXT or LOOP. A
+// missing keyword is reported without discarding the block parsed so far.
+func (p *parser) expectClosing(kind lexer.TokenKind) bool {
+	if p.currentToken().Kind != kind {
+		p.report(diagnostic.UnexpectedToken, p.currentToken(), "Expected '%s' but got '%s'", lexer.TokenKindString(kind), lexer.TokenKindString(p.currentToken().Kind))
+		return false
+	}
+	p.advance()
+	return true
+}
+
+// expectBlockEnd consumes the `END <keyword>` closing a block. A missing
+// terminator is reported without discarding the block parsed so far, and an
+// `END` closing another keyword is left to the enclosing block.
+func (p *parser) expectBlockEnd(keyword lexer.TokenKind) bool {
+	if p.currentToken().Kind != lexer.END {
+		p.report(diagnostic.UnexpectedToken, p.currentToken(), "Expected 'end %s' but got '%s'", lexer.TokenKindString(keyword), lexer.TokenKindString(p.currentToken().Kind))
+		return false
+	}
+	if p.peek().Kind != keyword {
+		p.report(diagnostic.UnexpectedToken, p.currentToken(), "Expected 'end %s' but got 'end %s'", lexer.TokenKindString(keyword), lexer.TokenKindString(p.peek().Kind))
+		return false
+	}
+	p.advance()
+	p.advance()
+	return true
+}
+func (p *parser) skipEmptyStatements() {
+	for p.currentToken().Kind == lexer.NEWLINE || p.currentToken().Kind == lexer.SEMICOLON {
+		p.advance()
+	}
+}
+
+// synchronize skips the remainder of a broken statement. It stops after the
+// next statement separator or in front of an END keyword so that an enclosing
+// block can still be closed, and always consumes at least one token.
+func (p *parser) synchronize(start int) {
+	if p.current == start && p.hasTokens() {
+		p.advance()
+	}
+	for p.hasTokens() {
+		switch p.currentToken().Kind {
+		case lexer.NEWLINE, lexer.SEMICOLON:
+			p.advance()
+			return
+		case lexer.END:
+			return
+		}
+		p.advance()
+	}
+}
 func (p *parser) expectError(expectedKind lexer.TokenKind, err any) lexer.Token {
 	token := p.currentToken()
 	kind := token.Kind
 
 	if kind != expectedKind {
 		if err == nil {
-			err = fmt.Sprintf("Expected %s but recieved %s\n", lexer.TokenKindString(expectedKind), lexer.TokenKindString(kind))
+			err = fmt.Sprintf("Expected %s but received %s", lexer.TokenKindString(expectedKind), lexer.TokenKindString(kind))
 		}
 
-		panic(err)
+		p.error(diagnostic.UnexpectedToken, token, "%v", err)
 	}
 
 	return p.advance()
@@ -71,7 +228,19 @@ func (p *parser) expectOneOf(expected ...lexer.TokenKind) lexer.Token {
 			return p.advance()
 		}
 	}
-	panic(fmt.Sprintf("Expected one of '%s' but got '%s'", joined, lexer.TokenKindString(kind)))
+	p.error(diagnostic.UnexpectedToken, token, "Expected one of '%s' but got '%s'", joined, lexer.TokenKindString(kind))
+	return token
+}
+
+// expectName consumes an identifier. Keywords and type names are accepted as
+// well since they are valid names for properties and functions of an object.
+func (p *parser) expectName() lexer.Token {
+	token := p.currentToken()
+	if token.Kind == lexer.IDENTIFIER || token.Kind == lexer.IDENTIFIER_TYPE || lexer.IsKeyword(token.Kind) {
+		return p.advance()
+	}
+	p.error(diagnostic.UnexpectedToken, token, "Expected a name but got '%s'", lexer.TokenKindString(token.Kind))
+	return token
 }
 func (p *parser) expect(expectedKind lexer.TokenKind) lexer.Token {
 	return p.expectError(expectedKind, nil)
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"pbls/src/ast"
+	"pbls/src/diagnostic"
 	"pbls/src/lexer"
 )
 
@@ -11,95 +12,539 @@ func parse_stmt(p *parser) ast.Stmt {
 	if exists {
 		return stmt_fn(p)
 	}
-	expression := parse_expr(p, default_bp)
-	p.expectOneOf(lexer.NEWLINE, lexer.SEMICOLON)
+	if p.currentToken().Kind == lexer.IDENTIFIER && p.peek().Kind == lexer.COLON {
+		return parse_label_stmt(p)
+	}
+	// A declaration of a variable with a user-defined type, e.g. `u_dw dw_1`.
+	if p.currentToken().Kind == lexer.IDENTIFIER && p.peek().Kind == lexer.IDENTIFIER {
+		return parse_var_decl_stmt(p)
+	}
+	return parse_expression_stmt(p)
+}
+
+// parse_expression_stmt parses an assignment or an expression such as a call.
+// PowerScript decides by position: a `=` following the first operand of a
+// statement assigns, any other `=` compares.
+func parse_expression_stmt(p *parser) ast.Stmt {
+	// Parsing above relational binding power leaves the `=` to the statement.
+	target := parse_expr(p, relational)
+	if assignment_lu[p.currentToken().Kind] {
+		return parse_assign_stmt(p, target)
+	}
+
+	expression := parse_expr_from(p, target, default_bp)
+	p.expectEndOfStatement()
 	return ast.ExprStmt{
+		Span: expression.Range(),
 		Expr: expression,
 	}
 }
 
-func parse_comma_separated_declaration(p *parser, t ast.Type, varList []ast.VarDeclStmt) ast.Stmt {
-	for {
-		currTkn := p.advance()
-		if currTkn.Kind == lexer.COMMA {
-			continue
-		} else if currTkn.Kind == lexer.NEWLINE || currTkn.Kind == lexer.SEMICOLON {
-			break
+func parse_assign_stmt(p *parser, target ast.Expr) ast.Stmt {
+	operator := p.advance()
+	switch target.(type) {
+	case ast.SymbolExpr, ast.MemberExpr, ast.IndexExpr:
+	default:
+		p.report(diagnostic.UnexpectedToken, operator, "The left-hand side of '%s' is not assignable", operator.Value)
+	}
+
+	value := parse_expr(p, default_bp)
+	stmt := ast.AssignStmt{
+		Span:     ast.Span{Start: target.Range().Start, End: value.Range().End},
+		Target:   target,
+		Operator: operator,
+		Value:    value,
+	}
+	p.expectEndOfStatement()
+	return stmt
+}
+
+// parse_stmt_with_recovery parses a single statement. A syntax error is
+// recorded as a diagnostic, the rest of the statement is skipped and a BadStmt
+// is returned in its place so that parsing can continue. Only the first
+// mistake of a statement is reported, the errors following it are skipped.
+func parse_stmt_with_recovery(p *parser) (stmt ast.Stmt) {
+	start := p.current
+	outerErrors := p.stmtErrors
+	p.stmtErrors = 0
+	defer func() {
+		reported := p.stmtErrors > 0
+		p.stmtErrors = outerErrors
+		if r := recover(); r != nil {
+			err, ok := r.(diagnostic.Diagnostic)
+			if !ok {
+				panic(r)
+			}
+			if !reported {
+				p.diagnostics = append(p.diagnostics, err)
+			}
+			p.synchronize(start)
+			stmt = ast.BadStmt{Span: p.spanFrom(startOf(p.tokens[start]))}
 		}
-		varList = append(varList, ast.VarDeclStmt{
-			Identifier:    currTkn.Value,
-			IsConstant:    false,
-			AssignedValue: nil,
-			ExplicitType:  t,
-		})
-	}
-	p.advance()
+	}()
+
+	return parse_stmt(p)
+}
+
+func parse_var_decl_stmt(p *parser) ast.Stmt {
+	start := startOf(p.currentToken())
+	var declaration ast.VarDeclStmt
+	parse_var_modifiers(p, &declaration)
+	varType := parse_type(p, default_bp)
+
+	varList := []ast.VarDeclStmt{parse_var_declarator(p, declaration, varType, start)}
+	for p.currentToken().Kind == lexer.COMMA {
+		p.advance()
+		varList = append(varList, parse_var_declarator(p, declaration, varType, startOf(p.currentToken())))
+	}
+	span := p.spanFrom(start)
+	p.expectEndOfStatement()
+
+	if len(varList) == 1 {
+		return varList[0]
+	}
 	return ast.MultiVarDeclStmt{
+		Span:  span,
 		Stmts: varList,
 	}
 }
 
-func parse_var_decl_stmt(p *parser) ast.Stmt {
-	var isConstant bool = false
-	var currTkn lexer.Token = p.currentToken()
-	var varType ast.Type
-
-	if currTkn.Kind == lexer.CONSTANT {
-		isConstant = true
-		currTkn = p.advance()
-	}
-	varType = parse_type(p, default_bp)
-	varName := p.advance()
-	var declaration ast.VarDeclStmt = ast.VarDeclStmt{
-		Identifier:    varName.Value,
-		IsConstant:    isConstant,
-		AssignedValue: nil,
-		ExplicitType:  varType,
-	}
-	currTkn = p.currentToken()
-	if currTkn.Kind == lexer.NEWLINE || currTkn.Kind == lexer.SEMICOLON {
-		return declaration
-	} else if currTkn.Kind == lexer.COMMA {
-		return parse_comma_separated_declaration(p, varType, []ast.VarDeclStmt{declaration})
-	} else if currTkn.Kind == lexer.EQUALS {
+// parse_var_declarator parses one `name[dimensions] = value` of a declaration.
+// The modifiers of the declaration are copied from template.
+func parse_var_declarator(p *parser, template ast.VarDeclStmt, varType ast.Type, start ast.Position) ast.VarDeclStmt {
+	declaration := template
+	varName := p.expect(lexer.IDENTIFIER)
+	declaration.Identifier = varName.Value
+	declaration.ExplicitType = varType
+
+	if p.currentToken().Kind == lexer.OPEN_BRACKET {
+		if declaration.IsConstant {
+			p.report(diagnostic.UnexpectedToken, p.currentToken(), "PowerBuilder does not allow the use of constant arrays!")
+		}
+		declaration.ExplicitType = parse_array_type(p, varType, default_bp)
+	}
+	if p.currentToken().Kind == lexer.EQUALS {
 		p.advance()
 		declaration.AssignedValue = parse_expr(p, default_bp)
+	} else if declaration.IsConstant {
+		p.report(diagnostic.UnexpectedToken, varName, "Constants need to be initialized!")
 	}
-	p.expectOneOf(lexer.NEWLINE, lexer.SEMICOLON)
-
+	declaration.Span = p.spanFrom(start)
 	return declaration
 }
 
-func _parse_var_decl_stmt(p *parser) ast.Stmt {
-	var isConstant bool = false
-	var currTkn lexer.Token = p.currentToken()
-	var varType ast.Type
-	var varValue ast.Expr
-
-	if currTkn.Kind == lexer.CONSTANT {
-		isConstant = true
-		currTkn = p.advance()
-	}
-	varType = parse_type(p, default_bp)
-	var varName = p.advance()
-
-	var declaration ast.VarDeclStmt = ast.VarDeclStmt{
-		Identifier:    varName.Value,
-		IsConstant:    isConstant,
-		AssignedValue: nil,
-		ExplicitType:  varType,
-	}
-	currTkn = p.advance()
-	if currTkn.Kind == lexer.COMMA {
-		return parse_comma_separated_declaration(p, varType, []ast.VarDeclStmt{declaration})
-	} else if currTkn.Kind == lexer.EQUALS {
-		varValue = parse_expr(p, default_bp)
-	} else if isConstant && p.currentToken().Kind == lexer.OPEN_BRACKET {
-		panic("PowerBuilder does not allow the use of constant arrays!")
-	} else if isConstant {
-		panic("Constants need to be initialized!")
-	}
-	p.expectOneOf(lexer.SEMICOLON, lexer.NEWLINE)
-	declaration.AssignedValue = varValue
-	return declaration
+// parse_var_modifiers consumes the scope, access and CONSTANT keywords in
+// front of the type of a declaration.
+func parse_var_modifiers(p *parser, declaration *ast.VarDeclStmt) {
+	for {
+		switch p.currentToken().Kind {
+		case lexer.GLOBAL:
+			declaration.Scope = ast.GlobalScope
+		case lexer.PUBLIC:
+			declaration.Access = ast.PublicAccess
+		case lexer.PROTECTED:
+			declaration.Access = ast.ProtectedAccess
+		case lexer.PRIVATE:
+			declaration.Access = ast.PrivateAccess
+		case lexer.PROTECTEDREAD:
+			declaration.ReadAccess = ast.ProtectedAccess
+		case lexer.PRIVATEREAD:
+			declaration.ReadAccess = ast.PrivateAccess
+		case lexer.PROTECTEDWRITE:
+			declaration.WriteAccess = ast.ProtectedAccess
+		case lexer.PRIVATEWRITE:
+			declaration.WriteAccess = ast.PrivateAccess
+		case lexer.CONSTANT:
+			declaration.IsConstant = true
+		default:
+			return
+		}
+		p.advance()
+	}
+}
+
+// parse_block parses statements until one of the terminators (or the end of
+// the file) is reached. The terminator itself is not consumed.
+func parse_block(p *parser, terminators ...lexer.TokenKind) ast.BlockStmt {
+	body := make([]ast.Stmt, 0)
+	start := startOf(p.currentToken())
+
+	for p.skipEmptyStatements(); p.hasTokens(); p.skipEmptyStatements() {
+		if p.currentToken().IsOneOfMany(terminators...) {
+			break
+		}
+		body = append(body, parse_stmt_with_recovery(p))
+	}
+
+	span := ast.Span{Start: start, End: start}
+	if len(body) > 0 {
+		span = ast.Span{Start: body[0].Range().Start, End: body[len(body)-1].Range().End}
+	}
+	return ast.BlockStmt{
+		Span: span,
+		Body: body,
+	}
+}
+
+func parse_if_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	condition := parse_expr(p, default_bp)
+	p.expect(lexer.THEN)
+
+	if !p.atEndOfStatement() {
+		return parse_single_line_if_stmt(p, start, condition)
+	}
+
+	stmt := parse_if_branches(p, start, condition)
+	closed := p.expectBlockEnd(lexer.IF)
+	stmt.Span = p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+	return stmt
+}
+
+func parse_if_branches(p *parser, start ast.Position, condition ast.Expr) ast.IfStmt {
+	stmt := ast.IfStmt{
+		Span:       p.spanFrom(start),
+		Condition:  condition,
+		Consequent: parse_block(p, lexer.ELSEIF, lexer.ELSE, lexer.END),
+	}
+	if len(stmt.Consequent.Body) > 0 {
+		stmt.Span.End = stmt.Consequent.End
+	}
+
+	switch p.currentToken().Kind {
+	case lexer.ELSEIF:
+		elseIfStart := startOf(p.advance())
+		elseIfCondition := parse_expr(p, default_bp)
+		p.expect(lexer.THEN)
+		alternate := parse_if_branches(p, elseIfStart, elseIfCondition)
+		stmt.Alternate = alternate
+		stmt.Span.End = alternate.End
+	case lexer.ELSE:
+		elseToken := p.advance()
+		alternate := parse_block(p, lexer.END)
+		stmt.Alternate = alternate
+		stmt.Span.End = endOf(elseToken)
+		if len(alternate.Body) > 0 {
+			stmt.Span.End = alternate.End
+		}
+	}
+
+	return stmt
+}
+
+func parse_single_line_if_stmt(p *parser, start ast.Position, condition ast.Expr) ast.Stmt {
+	consequent := parse_then_stmt(p)
+
+	stmt := ast.IfStmt{
+		Condition:  condition,
+		Consequent: ast.BlockStmt{Span: consequent.Range(), Body: []ast.Stmt{consequent}},
+		SingleLine: true,
+	}
+	if p.currentToken().Kind == lexer.ELSE {
+		p.advance()
+		alternate := parse_stmt(p)
+		stmt.Alternate = ast.BlockStmt{Span: alternate.Range(), Body: []ast.Stmt{alternate}}
+		stmt.Span = ast.Span{Start: start, End: alternate.Range().End}
+	} else {
+		stmt.Span = ast.Span{Start: start, End: consequent.Range().End}
+	}
+	return stmt
+}
+
+func parse_then_stmt(p *parser) ast.Stmt {
+	p.singleLineIf++
+	defer func() { p.singleLineIf-- }()
+	return parse_stmt(p)
+}
+
+func parse_return_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	var value ast.Expr
+	if !p.atEndOfStatement() {
+		value = parse_expr(p, default_bp)
+	}
+	span := p.spanFrom(start)
+	p.expectEndOfStatement()
+
+	return ast.ReturnStmt{
+		Span:  span,
+		Value: value,
+	}
+}
+func parse_exit_stmt(p *parser) ast.Stmt {
+	span := tokenSpan(p.advance())
+	p.expectEndOfStatement()
+	return ast.ExitStmt{Span: span}
+}
+func parse_continue_stmt(p *parser) ast.Stmt {
+	span := tokenSpan(p.advance())
+	p.expectEndOfStatement()
+	return ast.ContinueStmt{Span: span}
+}
+func parse_halt_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	isClose := false
+	if p.currentToken().Kind == lexer.CLOSE {
+		p.advance()
+		isClose = true
+	}
+	span := p.spanFrom(start)
+	p.expectEndOfStatement()
+
+	return ast.HaltStmt{
+		Span:  span,
+		Close: isClose,
+	}
+}
+func parse_goto_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	label := p.expect(lexer.IDENTIFIER)
+	span := p.spanFrom(start)
+	p.expectEndOfStatement()
+
+	return ast.GotoStmt{
+		Span:  span,
+		Label: label.Value,
+	}
+}
+
+// parse_label_stmt parses a `label:` definition. The labelled statement
+// follows as a statement of its own.
+func parse_label_stmt(p *parser) ast.Stmt {
+	name := p.advance()
+	p.expect(lexer.COLON)
+
+	return ast.LabelStmt{
+		Span: p.spanFrom(startOf(name)),
+		Name: name.Value,
+	}
+}
+
+func parse_choose_case_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	p.expect(lexer.CASE)
+	subject := parse_expr(p, default_bp)
+	p.expectEndOfStatement()
+
+	cases := make([]ast.CaseClause, 0)
+	for p.skipEmptyStatements(); p.currentToken().Kind == lexer.CASE; {
+		cases = append(cases, parse_case_clause(p))
+	}
+	closed := p.expectBlockEnd(lexer.CHOOSE)
+	span := p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+
+	return ast.ChooseCaseStmt{
+		Span:    span,
+		Subject: subject,
+		Cases:   cases,
+	}
+}
+
+func parse_case_clause(p *parser) ast.CaseClause {
+	start := startOf(p.expect(lexer.CASE))
+	clause := ast.CaseClause{
+		Conditions: make([]ast.CaseCondition, 0),
+	}
+
+	if p.currentToken().Kind == lexer.ELSE {
+		p.advance()
+		clause.IsElse = true
+	} else {
+		clause.Conditions = append(clause.Conditions, parse_case_condition(p))
+		for p.currentToken().Kind == lexer.COMMA {
+			p.advance()
+			clause.Conditions = append(clause.Conditions, parse_case_condition(p))
+		}
+	}
+	clause.Span = p.spanFrom(start)
+	p.expectEndOfStatement()
+
+	clause.Body = parse_block(p, lexer.CASE, lexer.END)
+	if len(clause.Body.Body) > 0 {
+		clause.Span.End = clause.Body.End
+	}
+	return clause
+}
+
+func parse_case_condition(p *parser) ast.CaseCondition {
+	start := startOf(p.currentToken())
+
+	if p.currentToken().Kind == lexer.IS {
+		p.advance()
+		operator := p.expectOneOf(lexer.EQUALS, lexer.NOT_EQUALS, lexer.LESS, lexer.LESS_EQUAL, lexer.GREATER, lexer.GREATER_EQUAL)
+		value := parse_expr(p, default_bp)
+		return ast.CaseIs{
+			Span:     p.spanFrom(start),
+			Operator: operator,
+			Value:    value,
+		}
+	}
+
+	value := parse_expr(p, default_bp)
+	if p.currentToken().Kind == lexer.TO {
+		p.advance()
+		to := parse_expr(p, default_bp)
+		return ast.CaseRange{
+			Span: p.spanFrom(start),
+			From: value,
+			To:   to,
+		}
+	}
+
+	return ast.CaseValue{
+		Span:  value.Range(),
+		Value: value,
+	}
+}
+
+func parse_for_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	// Parsing above relational binding power leaves the `=` to the loop header.
+	variable := parse_expr(p, relational)
+	p.expect(lexer.EQUALS)
+	from := parse_expr(p, default_bp)
+	p.expect(lexer.TO)
+	to := parse_expr(p, default_bp)
+
+	var step ast.Expr
+	if p.currentToken().Kind == lexer.STEP {
+		p.advance()
+		step = parse_expr(p, default_bp)
+	}
+	p.expectEndOfStatement()
+
+	body := parse_block(p, lexer.NEXT, lexer.END)
+	closed := p.expectClosing(lexer.NEXT)
+	span := p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+
+	return ast.ForStmt{
+		Span:     span,
+		Variable: variable,
+		From:     from,
+		To:       to,
+		Step:     step,
+		Body:     body,
+	}
+}
+
+func parse_do_loop_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	stmt := ast.DoLoopStmt{}
+
+	if p.currentToken().Kind == lexer.WHILE || p.currentToken().Kind == lexer.UNTIL {
+		stmt.Until = p.advance().Kind == lexer.UNTIL
+		stmt.Condition = parse_expr(p, default_bp)
+	}
+	p.expectEndOfStatement()
+
+	stmt.Body = parse_block(p, lexer.LOOP, lexer.END)
+	closed := p.expectClosing(lexer.LOOP)
+
+	if closed && (p.currentToken().Kind == lexer.WHILE || p.currentToken().Kind == lexer.UNTIL) {
+		if stmt.Condition != nil {
+			p.error(diagnostic.UnexpectedToken, p.currentToken(), "A DO loop cannot have a condition after both DO and LOOP")
+		}
+		stmt.Until = p.advance().Kind == lexer.UNTIL
+		stmt.Condition = parse_expr(p, default_bp)
+		stmt.TestAtEnd = true
+	}
+	stmt.Span = p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+
+	return stmt
+}
+
+func parse_try_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	p.expectEndOfStatement()
+
+	stmt := ast.TryStmt{
+		Body:    parse_block(p, lexer.CATCH, lexer.FINALLY, lexer.END),
+		Catches: make([]ast.CatchClause, 0),
+	}
+	for p.currentToken().Kind == lexer.CATCH {
+		stmt.Catches = append(stmt.Catches, parse_catch_clause(p))
+	}
+	if p.currentToken().Kind == lexer.FINALLY {
+		p.advance()
+		p.expectEndOfStatement()
+		finally := parse_block(p, lexer.END)
+		stmt.Finally = &finally
+	}
+	closed := p.expectBlockEnd(lexer.TRY)
+	stmt.Span = p.spanFrom(start)
+	if closed {
+		p.expectEndOfStatement()
+	}
+
+	return stmt
+}
+
+func parse_catch_clause(p *parser) ast.CatchClause {
+	start := startOf(p.advance())
+	p.expect(lexer.OPEN_PAREN)
+	exceptionType := parse_type(p, default_bp)
+	identifier := p.expect(lexer.IDENTIFIER)
+	p.expect(lexer.CLOSE_PAREN)
+
+	clause := ast.CatchClause{
+		Span:          p.spanFrom(start),
+		ExceptionType: exceptionType,
+		Identifier:    identifier.Value,
+	}
+	p.expectEndOfStatement()
+
+	clause.Body = parse_block(p, lexer.CATCH, lexer.FINALLY, lexer.END)
+	if len(clause.Body.Body) > 0 {
+		clause.Span.End = clause.Body.End
+	}
+	return clause
+}
+
+func parse_throw_stmt(p *parser) ast.Stmt {
+	start := startOf(p.advance())
+	value := parse_expr(p, default_bp)
+	span := p.spanFrom(start)
+	p.expectEndOfStatement()
+
+	return ast.ThrowStmt{
+		Span:  span,
+		Value: value,
+	}
+}
+
+func parse_destroy_stmt(p *parser) ast.Stmt {
+	start := startOf(p.expect(lexer.DESTROY))
+	value := parse_expr(p, default_bp)
+	stmt := ast.DestroyStmt{
+		Span:  p.spanFrom(start),
+		Value: value,
+	}
+	p.expectEndOfStatement()
+	return stmt
+}
+
+func parse_call_stmt(p *parser) ast.Stmt {
+	start := startOf(p.expect(lexer.CALL))
+	stmt := ast.CallStmt{Ancestor: p.expectName().Value}
+	if p.currentToken().Kind == lexer.BACKTICK {
+		p.advance()
+		stmt.Control = p.expectName().Value
+	}
+	p.expect(lexer.COLON_COLON)
+	stmt.Event = p.expectName().Value
+	stmt.Span = p.spanFrom(start)
+	p.expectEndOfStatement()
+	return stmt
 }
@@ -1,9 +1,10 @@
 package parser
 
 import (
-	"fmt"
 	"pbls/src/ast"
+	"pbls/src/diagnostic"
 	"pbls/src/lexer"
+	"strconv"
 )
 
 type type_nud_handler func(p *parser) ast.Type
@@ -27,17 +28,83 @@ func type_nud(kind lexer.TokenKind, nud_fn type_nud_handler) {
 }
 func createTypeTokenLookups() {
 	type_nud(lexer.IDENTIFIER_TYPE, parse_symbol_type)
+	type_nud(lexer.IDENTIFIER, parse_symbol_type)
+	type_led(lexer.OPEN_BRACKET, call, parse_array_type)
+	type_led(lexer.OPEN_CURLY, call, parse_precision_type)
 }
+
+// parse_symbol_type parses a built-in datatype, stored under its canonical
+// name, or the name of a class such as an exception or window.
 func parse_symbol_type(p *parser) ast.Type {
+	tkn := p.expectOneOf(lexer.IDENTIFIER_TYPE, lexer.IDENTIFIER)
+	name, builtin := lexer.TypeName(tkn.Value)
+	if !builtin {
+		name = tkn.Value
+	}
 	return ast.SymbolType{
-		Name: p.expect(lexer.IDENTIFIER_TYPE).Value,
+		Span: tokenSpan(tkn),
+		Name: name,
+	}
+}
+
+// parse_precision_type parses the `{n}` following decimal and blob.
+func parse_precision_type(p *parser, left ast.Type, bp BindingPower) ast.Type {
+	open := p.expect(lexer.OPEN_CURLY)
+	number := p.expect(lexer.NUMBER)
+	p.expect(lexer.CLOSE_CURLY)
+
+	symbol, ok := left.(ast.SymbolType)
+	if !ok || (symbol.Name != "decimal" && symbol.Name != "blob") || symbol.Precision != nil {
+		p.report(diagnostic.UnexpectedToken, open, "Only decimal and blob take a precision")
+		return left
+	}
+	precision, err := strconv.Atoi(number.Value)
+	if err != nil {
+		p.report(diagnostic.UnexpectedToken, number, "Expected a whole number but got '%s'", number.Value)
+		return left
+	}
+	symbol.Precision = &precision
+	symbol.Span = p.spanFrom(symbol.Start)
+	return symbol
+}
+
+// parse_array_type parses the brackets of an array, which follow the type or,
+// in declarations, the variable name.
+func parse_array_type(p *parser, left ast.Type, bp BindingPower) ast.Type {
+	p.expect(lexer.OPEN_BRACKET)
+	p.groupDepth++
+	defer func() { p.groupDepth-- }()
+	dimensions := make([]ast.ArrayDimension, 0)
+	if p.currentToken().Kind != lexer.CLOSE_BRACKET {
+		dimensions = append(dimensions, parse_array_dimension(p))
+		for p.currentToken().Kind == lexer.COMMA {
+			p.advance()
+			dimensions = append(dimensions, parse_array_dimension(p))
+		}
+	}
+	p.expect(lexer.CLOSE_BRACKET)
+	return ast.ArrayType{
+		Span:       p.spanFrom(left.Range().Start),
+		Underlying: left,
+		Dimensions: dimensions,
+	}
+}
+func parse_array_dimension(p *parser) ast.ArrayDimension {
+	start := startOf(p.currentToken())
+	dimension := ast.ArrayDimension{Upper: parse_expr(p, default_bp)}
+	if p.currentToken().Kind == lexer.TO {
+		p.advance()
+		dimension.Lower = dimension.Upper
+		dimension.Upper = parse_expr(p, default_bp)
 	}
+	dimension.Span = p.spanFrom(start)
+	return dimension
 }
 func parse_type(p *parser, bp BindingPower) ast.Type {
 	tokenKind := p.currentToken().Kind
 	nud_fn, exists := type_nud_lu[tokenKind]
 	if !exists {
-		panic(fmt.Sprintf("1-TYPE NUD HANDLER EXPECTED FOR TOKEN %s\n", lexer.TokenKindString(tokenKind)))
+		p.error(diagnostic.ExpectedType, p.currentToken(), "Expected a type but got '%s'", lexer.TokenKindString(tokenKind))
 	}
 
 	left := nud_fn(p)
@@ -45,10 +112,26 @@ func parse_type(p *parser, bp BindingPower) ast.Type {
 		tokenKind := p.currentToken().Kind
 		led_fn, exists := type_led_lu[tokenKind]
 		if !exists {
-			panic(fmt.Sprintf("2-TYPE LED HANDLER EXPECTED FOR TOKEN %s\n", lexer.TokenKindString(tokenKind)))
+			p.error(diagnostic.UnexpectedToken, p.currentToken(), "Unexpected '%s' in type", lexer.TokenKindString(tokenKind))
 		}
 		left = led_fn(p, left, type_bp_lu[p.currentToken().Kind])
 	}
 
 	return left
 }
+
+// parse_throws_clause parses the optional `THROWS Type[, Type]*` of a
+// function declaration.
+func parse_throws_clause(p *parser) []ast.Type {
+	throws := make([]ast.Type, 0)
+	if p.currentToken().Kind != lexer.THROWS {
+		return throws
+	}
+	p.advance()
+	throws = append(throws, parse_type(p, default_bp))
+	for p.currentToken().Kind == lexer.COMMA {
+		p.advance()
+		throws = append(throws, parse_type(p, default_bp))
+	}
+	return throws
+}
@@ -0,0 +1,38 @@
+package lexer_test
+
+import (
+	"fmt"
+	"pbls/src/lexer"
+	"strings"
+	"testing"
+)
+
+const benchmarkScript = `// of_check_row
+long ll_row
+string ls_sperre = "S", ls_info = 'none'
+/* validate the
+   current row */
+ll_row = this.getrow()
+if ll_row <= 0 then return 0
+ls_sperre = this.getitemstring( ll_row, 'sperre_vfa')
+if ls_sperre = 'S' then
+	canedit(false, c.s_upd_forbid_info + c.s_sperreallg_1_info )
+end if
+li_count += 1
+`
+
+// BenchmarkTokenize reports the throughput for growing inputs. A constant
+// MB/s across the sizes shows that tokenizing runs in linear time.
+func BenchmarkTokenize(b *testing.B) {
+	for _, copies := range []int{100, 1000, 10000} {
+		source := []byte(strings.Repeat(benchmarkScript, copies))
+		lines := copies * strings.Count(benchmarkScript, "\n")
+
+		b.Run(fmt.Sprintf("lines=%d", lines), func(b *testing.B) {
+			b.SetBytes(int64(len(source)))
+			for i := 0; i < b.N; i++ {
+				lexer.Tokenize(source)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package lexer_test
 
 import (
+	"pbls/src/diagnostic"
 	"pbls/src/lexer"
 	"testing"
 )
@@ -19,14 +20,14 @@ func compareTokens(t *testing.T, expected, actual []lexer.Token) {
 func TestSingleTokens(t *testing.T) {
 	input := `{ ( ) }`
 	expected := []lexer.Token{
-		{Kind: lexer.OPEN_CURLY, Value: "{", Line: 1, Column: 1},
-		{Kind: lexer.OPEN_PAREN, Value: "(", Line: 1, Column: 3},
-		{Kind: lexer.CLOSE_PAREN, Value: ")", Line: 1, Column: 5},
-		{Kind: lexer.CLOSE_CURLY, Value: "}", Line: 1, Column: 7},
-		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 0},
+		{Kind: lexer.OPEN_CURLY, Value: "{", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.OPEN_PAREN, Value: "(", Line: 1, Column: 3, Offset: 2},
+		{Kind: lexer.CLOSE_PAREN, Value: ")", Line: 1, Column: 5, Offset: 4},
+		{Kind: lexer.CLOSE_CURLY, Value: "}", Line: 1, Column: 7, Offset: 6},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 8, Offset: 7},
 	}
 
-	tokens := lexer.Tokenize([]byte(input))
+	tokens, _ := lexer.Tokenize([]byte(input))
 
 	compareTokens(t, expected, tokens)
 }
@@ -34,15 +35,15 @@ func TestSingleTokens(t *testing.T) {
 func TestReservedKeywords(t *testing.T) {
 	input := `if else while true false`
 	expected := []lexer.Token{
-		{Kind: lexer.IF, Value: "if", Line: 1, Column: 1},
-		{Kind: lexer.ELSE, Value: "else", Line: 1, Column: 4},
-		{Kind: lexer.WHILE, Value: "while", Line: 1, Column: 9},
-		{Kind: lexer.TRUE, Value: "true", Line: 1, Column: 15},
-		{Kind: lexer.FALSE, Value: "false", Line: 1, Column: 20},
-		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 0},
+		{Kind: lexer.IF, Value: "if", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.ELSE, Value: "else", Line: 1, Column: 4, Offset: 3},
+		{Kind: lexer.WHILE, Value: "while", Line: 1, Column: 9, Offset: 8},
+		{Kind: lexer.TRUE, Value: "true", Line: 1, Column: 15, Offset: 14},
+		{Kind: lexer.FALSE, Value: "false", Line: 1, Column: 20, Offset: 19},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 25, Offset: 24},
 	}
 
-	tokens := lexer.Tokenize([]byte(input))
+	tokens, _ := lexer.Tokenize([]byte(input))
 
 	compareTokens(t, expected, tokens)
 }
@@ -50,14 +51,14 @@ func TestReservedKeywords(t *testing.T) {
 func TestIdentifiersAndNumbers(t *testing.T) {
 	input := `x1 varName 123 45.67`
 	expected := []lexer.Token{
-		{Kind: lexer.IDENTIFIER, Value: "x1", Line: 1, Column: 1},
-		{Kind: lexer.IDENTIFIER, Value: "varName", Line: 1, Column: 4},
-		{Kind: lexer.NUMBER, Value: "123", Line: 1, Column: 12},
-		{Kind: lexer.NUMBER, Value: "45.67", Line: 1, Column: 16},
-		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 0},
+		{Kind: lexer.IDENTIFIER, Value: "x1", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.IDENTIFIER, Value: "varName", Line: 1, Column: 4, Offset: 3},
+		{Kind: lexer.NUMBER, Value: "123", Line: 1, Column: 12, Offset: 11},
+		{Kind: lexer.NUMBER, Value: "45.67", Line: 1, Column: 16, Offset: 15},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 21, Offset: 20},
 	}
 
-	tokens := lexer.Tokenize([]byte(input))
+	tokens, _ := lexer.Tokenize([]byte(input))
 
 	compareTokens(t, expected, tokens)
 }
@@ -65,12 +66,12 @@ func TestIdentifiersAndNumbers(t *testing.T) {
 func TestStrings(t *testing.T) {
 	input := `"hello" "world"`
 	expected := []lexer.Token{
-		{Kind: lexer.STRING, Value: "hello", Line: 1, Column: 1},
-		{Kind: lexer.STRING, Value: "world", Line: 1, Column: 9},
-		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 0},
+		{Kind: lexer.STRING, Value: "hello", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.STRING, Value: "world", Line: 1, Column: 9, Offset: 8},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 16, Offset: 15},
 	}
 
-	tokens := lexer.Tokenize([]byte(input))
+	tokens, _ := lexer.Tokenize([]byte(input))
 
 	compareTokens(t, expected, tokens)
 }
@@ -78,23 +79,256 @@ func TestStrings(t *testing.T) {
 func TestMixedInput(t *testing.T) {
 	input := "if (x > 10)\n{ return 'done'; }\r\n"
 	expected := []lexer.Token{
-		{Kind: lexer.IF, Value: "if", Line: 1, Column: 1},
-		{Kind: lexer.OPEN_PAREN, Value: "(", Line: 1, Column: 4},
-		{Kind: lexer.IDENTIFIER, Value: "x", Line: 1, Column: 5},
-		{Kind: lexer.GREATER, Value: ">", Line: 1, Column: 7},
-		{Kind: lexer.NUMBER, Value: "10", Line: 1, Column: 9},
-		{Kind: lexer.CLOSE_PAREN, Value: ")", Line: 1, Column: 11},
-		{Kind: lexer.NEWLINE, Value: `n`, Line: 2, Column: 1},
-		{Kind: lexer.OPEN_CURLY, Value: "{", Line: 2, Column: 2},
-		{Kind: lexer.RETURN, Value: "return", Line: 2, Column: 4},
-		{Kind: lexer.STRING, Value: "done", Line: 2, Column: 11},
-		{Kind: lexer.SEMICOLON, Value: ";", Line: 2, Column: 17},
-		{Kind: lexer.CLOSE_CURLY, Value: "}", Line: 2, Column: 19},
-		{Kind: lexer.NEWLINE, Value: `rn`, Line: 2, Column: 20},
-		{Kind: lexer.EOF, Value: "EOF", Line: 2, Column: 0},
-	}
-
-	tokens := lexer.Tokenize([]byte(input))
+		{Kind: lexer.IF, Value: "if", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.OPEN_PAREN, Value: "(", Line: 1, Column: 4, Offset: 3},
+		{Kind: lexer.IDENTIFIER, Value: "x", Line: 1, Column: 5, Offset: 4},
+		{Kind: lexer.GREATER, Value: ">", Line: 1, Column: 7, Offset: 6},
+		{Kind: lexer.NUMBER, Value: "10", Line: 1, Column: 9, Offset: 8},
+		{Kind: lexer.CLOSE_PAREN, Value: ")", Line: 1, Column: 11, Offset: 10},
+		{Kind: lexer.NEWLINE, Value: `n`, Line: 1, Column: 12, Offset: 11},
+		{Kind: lexer.OPEN_CURLY, Value: "{", Line: 2, Column: 1, Offset: 12},
+		{Kind: lexer.RETURN, Value: "return", Line: 2, Column: 3, Offset: 14},
+		{Kind: lexer.STRING, Value: "done", Line: 2, Column: 10, Offset: 21},
+		{Kind: lexer.SEMICOLON, Value: ";", Line: 2, Column: 16, Offset: 27},
+		{Kind: lexer.CLOSE_CURLY, Value: "}", Line: 2, Column: 18, Offset: 29},
+		{Kind: lexer.NEWLINE, Value: `rn`, Line: 2, Column: 19, Offset: 30},
+		{Kind: lexer.EOF, Value: "EOF", Line: 3, Column: 1, Offset: 32},
+	}
+
+	tokens, _ := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+}
+
+func TestUnrecognizedCharacter(t *testing.T) {
+	input := `x @ 1`
+	expected := []lexer.Token{
+		{Kind: lexer.IDENTIFIER, Value: "x", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.NUMBER, Value: "1", Line: 1, Column: 5, Offset: 4},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 6, Offset: 5},
+	}
+
+	tokens, diagnostics := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(diagnostics))
+	}
+	if diagnostics[0].Code != diagnostic.UnrecognizedToken || diagnostics[0].StartColumn != 3 {
+		t.Errorf("unexpected diagnostic %v", diagnostics[0])
+	}
+}
+
+func TestPositionsAfterMultilineComment(t *testing.T) {
+	input := "/* a\nb */ x\ny"
+	expected := []lexer.Token{
+		{Kind: lexer.IDENTIFIER, Value: "x", Line: 2, Column: 6, Offset: 10},
+		{Kind: lexer.NEWLINE, Value: "n", Line: 2, Column: 7, Offset: 11},
+		{Kind: lexer.IDENTIFIER, Value: "y", Line: 3, Column: 1, Offset: 12},
+		{Kind: lexer.EOF, Value: "EOF", Line: 3, Column: 2, Offset: 13},
+	}
+
+	tokens, _ := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+}
+
+func TestKeywordsIgnoreCase(t *testing.T) {
+	input := `IF End If Return String Long`
+	expected := []lexer.Token{
+		{Kind: lexer.IF, Value: "IF", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.END, Value: "End", Line: 1, Column: 4, Offset: 3},
+		{Kind: lexer.IF, Value: "If", Line: 1, Column: 8, Offset: 7},
+		{Kind: lexer.RETURN, Value: "Return", Line: 1, Column: 11, Offset: 10},
+		{Kind: lexer.IDENTIFIER_TYPE, Value: "String", Line: 1, Column: 18, Offset: 17},
+		{Kind: lexer.IDENTIFIER_TYPE, Value: "Long", Line: 1, Column: 25, Offset: 24},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 29, Offset: 28},
+	}
+
+	tokens, _ := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+}
+
+func TestBuiltinTypesMatchWholeWords(t *testing.T) {
+	input := `integer longlong stringval internal_id Dec`
+	expected := []lexer.Token{
+		{Kind: lexer.IDENTIFIER_TYPE, Value: "integer", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.IDENTIFIER_TYPE, Value: "longlong", Line: 1, Column: 9, Offset: 8},
+		{Kind: lexer.IDENTIFIER, Value: "stringval", Line: 1, Column: 18, Offset: 17},
+		{Kind: lexer.IDENTIFIER, Value: "internal_id", Line: 1, Column: 28, Offset: 27},
+		{Kind: lexer.IDENTIFIER_TYPE, Value: "Dec", Line: 1, Column: 40, Offset: 39},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 43, Offset: 42},
+	}
+
+	tokens, _ := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+}
+
+func TestOperators(t *testing.T) {
+	input := `a += 1 // comment
+b<=c-1.5`
+	expected := []lexer.Token{
+		{Kind: lexer.IDENTIFIER, Value: "a", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.PLUS_EQUALS, Value: "+=", Line: 1, Column: 3, Offset: 2},
+		{Kind: lexer.NUMBER, Value: "1", Line: 1, Column: 6, Offset: 5},
+		{Kind: lexer.NEWLINE, Value: "n", Line: 1, Column: 18, Offset: 17},
+		{Kind: lexer.IDENTIFIER, Value: "b", Line: 2, Column: 1, Offset: 18},
+		{Kind: lexer.LESS_EQUAL, Value: "<=", Line: 2, Column: 2, Offset: 19},
+		{Kind: lexer.IDENTIFIER, Value: "c", Line: 2, Column: 4, Offset: 21},
+		{Kind: lexer.MINUS, Value: "-", Line: 2, Column: 5, Offset: 22},
+		{Kind: lexer.NUMBER, Value: "1.5", Line: 2, Column: 6, Offset: 23},
+		{Kind: lexer.EOF, Value: "EOF", Line: 2, Column: 9, Offset: 26},
+	}
+
+	tokens, _ := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+}
+
+func TestUnterminatedString(t *testing.T) {
+	input := "x = \"abc\ny"
+	expected := []lexer.Token{
+		{Kind: lexer.IDENTIFIER, Value: "x", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.EQUALS, Value: "=", Line: 1, Column: 3, Offset: 2},
+		{Kind: lexer.NEWLINE, Value: "n", Line: 1, Column: 9, Offset: 8},
+		{Kind: lexer.IDENTIFIER, Value: "y", Line: 2, Column: 1, Offset: 9},
+		{Kind: lexer.EOF, Value: "EOF", Line: 2, Column: 2, Offset: 10},
+	}
+
+	tokens, diagnostics := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+	if len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.UnterminatedString {
+		t.Errorf("expected an unterminated string diagnostic, got %v", diagnostics)
+	}
+}
+
+func TestExportHeader(t *testing.T) {
+	input := "$PBExportHeader$w_main.srw\r\n$PBExportComments$\r\nalign = center!"
+	expected := []lexer.Token{
+		{Kind: lexer.EXPORT_HEADER, Value: "$PBExportHeader$w_main.srw", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.NEWLINE, Value: "rn", Line: 1, Column: 27, Offset: 26},
+		{Kind: lexer.EXPORT_COMMENTS, Value: "$PBExportComments$", Line: 2, Column: 1, Offset: 28},
+		{Kind: lexer.NEWLINE, Value: "rn", Line: 2, Column: 19, Offset: 46},
+		{Kind: lexer.IDENTIFIER, Value: "align", Line: 3, Column: 1, Offset: 48},
+		{Kind: lexer.EQUALS, Value: "=", Line: 3, Column: 7, Offset: 54},
+		{Kind: lexer.ENUM_VALUE, Value: "center!", Line: 3, Column: 9, Offset: 56},
+		{Kind: lexer.EOF, Value: "EOF", Line: 3, Column: 16, Offset: 63},
+	}
+
+	tokens, diagnostics := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+	if len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+}
+
+func TestPowerScriptOperators(t *testing.T) {
+	input := `a <> b ^ 2 not c ^= d %= e++`
+	expected := []lexer.Token{
+		{Kind: lexer.IDENTIFIER, Value: "a", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.NOT_EQUALS, Value: "<>", Line: 1, Column: 3, Offset: 2},
+		{Kind: lexer.IDENTIFIER, Value: "b", Line: 1, Column: 6, Offset: 5},
+		{Kind: lexer.CARET, Value: "^", Line: 1, Column: 8, Offset: 7},
+		{Kind: lexer.NUMBER, Value: "2", Line: 1, Column: 10, Offset: 9},
+		{Kind: lexer.NOT, Value: "not", Line: 1, Column: 12, Offset: 11},
+		{Kind: lexer.IDENTIFIER, Value: "c", Line: 1, Column: 16, Offset: 15},
+		{Kind: lexer.CARET_EQUALS, Value: "^=", Line: 1, Column: 18, Offset: 17},
+		{Kind: lexer.IDENTIFIER, Value: "d", Line: 1, Column: 21, Offset: 20},
+		{Kind: lexer.PERCENT_EQUALS, Value: "%=", Line: 1, Column: 23, Offset: 22},
+		{Kind: lexer.IDENTIFIER, Value: "e", Line: 1, Column: 26, Offset: 25},
+		{Kind: lexer.PLUS_PLUS, Value: "++", Line: 1, Column: 27, Offset: 26},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 29, Offset: 28},
+	}
+
+	tokens, _ := lexer.Tokenize([]byte(input))
 
 	compareTokens(t, expected, tokens)
 }
+
+func TestExclamationMarkIsNotAnOperator(t *testing.T) {
+	_, diagnostics := lexer.Tokenize([]byte(`if ! a then`))
+	if len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.UnrecognizedToken {
+		t.Errorf("expected '!' to be unrecognized, got %v", diagnostics)
+	}
+}
+
+func TestLineContinuation(t *testing.T) {
+	input := "a = b + &  // more\r\n\tc\nd"
+	expected := []lexer.Token{
+		{Kind: lexer.IDENTIFIER, Value: "a", Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.EQUALS, Value: "=", Line: 1, Column: 3, Offset: 2},
+		{Kind: lexer.IDENTIFIER, Value: "b", Line: 1, Column: 5, Offset: 4},
+		{Kind: lexer.PLUS, Value: "+", Line: 1, Column: 7, Offset: 6},
+		{Kind: lexer.IDENTIFIER, Value: "c", Line: 2, Column: 2, Offset: 21},
+		{Kind: lexer.NEWLINE, Value: "n", Line: 2, Column: 3, Offset: 22},
+		{Kind: lexer.IDENTIFIER, Value: "d", Line: 3, Column: 1, Offset: 23},
+		{Kind: lexer.EOF, Value: "EOF", Line: 3, Column: 2, Offset: 24},
+	}
+
+	tokens, diagnostics := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+	if len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+}
+
+func TestContinuationInsideLine(t *testing.T) {
+	tokens, diagnostics := lexer.Tokenize([]byte("a & b"))
+	if len(tokens) != 3 || len(diagnostics) != 1 || diagnostics[0].StartColumn != 3 {
+		t.Errorf("expected '&' inside a line to be reported, got %v %v", tokens, diagnostics)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	input := `"He said ~"hi~"" 'it~'s' x`
+	expected := []lexer.Token{
+		{Kind: lexer.STRING, Value: `He said ~"hi~"`, Line: 1, Column: 1, Offset: 0},
+		{Kind: lexer.STRING, Value: `it~'s`, Line: 1, Column: 18, Offset: 17},
+		{Kind: lexer.IDENTIFIER, Value: "x", Line: 1, Column: 26, Offset: 25},
+		{Kind: lexer.EOF, Value: "EOF", Line: 1, Column: 27, Offset: 26},
+	}
+
+	tokens, diagnostics := lexer.Tokenize([]byte(input))
+
+	compareTokens(t, expected, tokens)
+	if len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+}
+
+func TestUnescapeString(t *testing.T) {
+	tests := map[string]string{
+		`plain`:             "plain",
+		`~"hi~"`:            `"hi"`,
+		`a~tb~r~nc`:         "a\tb\r\nc",
+		`~~ and ~'`:         "~ and '",
+		`~065~h42~o103`:     "ABC",
+		`~h4`:               "~h4",
+		`~q stays`:          "~q stays",
+		`~256 is too large`: "~256 is too large",
+		`trailing~`:         "trailing~",
+	}
+	for raw, expected := range tests {
+		if actual := lexer.UnescapeString(raw); actual != expected {
+			t.Errorf("%s: expected %q, got %q", raw, expected, actual)
+		}
+	}
+}
+
+func TestInvalidEscapes(t *testing.T) {
+	_, diagnostics := lexer.Tokenize([]byte(`x = "a~qb~hZZ~o777"`))
+	if len(diagnostics) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %v", diagnostics)
+	}
+	columns := []int{7, 10, 14}
+	for i, d := range diagnostics {
+		if d.Code != diagnostic.InvalidEscape || d.StartColumn != columns[i] {
+			t.Errorf("unexpected diagnostic %v", d)
+		}
+	}
+}
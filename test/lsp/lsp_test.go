@@ -0,0 +1,218 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"pbls/src/lsp"
+	"strings"
+	"testing"
+)
+
+func frame(t *testing.T, messages ...string) *bytes.Buffer {
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		if err := lsp.WriteMessage(&buf, []byte(msg)); err != nil {
+			t.Fatalf("could not frame message: %s", err)
+		}
+	}
+	return &buf
+}
+
+func readAll(t *testing.T, out *bytes.Buffer) []map[string]any {
+	var messages []map[string]any
+	reader := bufio.NewReader(out)
+	for {
+		payload, err := lsp.ReadMessage(reader)
+		if err != nil {
+			break
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("server wrote invalid JSON: %s", payload)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func run(t *testing.T, messages ...string) (int, []map[string]any) {
+	var out bytes.Buffer
+	code := lsp.NewServer(frame(t, messages...), &out).Run()
+	return code, readAll(t, &out)
+}
+
+const initialize = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"processId":null}}`
+const initialized = `{"jsonrpc":"2.0","method":"initialized","params":{}}`
+const shutdown = `{"jsonrpc":"2.0","id":2,"method":"shutdown"}`
+const exit = `{"jsonrpc":"2.0","method":"exit"}`
+
+func TestReadMessage(t *testing.T) {
+	input := "Content-Length: 17\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n{\"jsonrpc\":\"2.0\"}"
+	payload, err := lsp.ReadMessage(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(payload) != `{"jsonrpc":"2.0"}` {
+		t.Fatalf("unexpected payload %q", payload)
+	}
+}
+
+func TestReadMessageWithoutContentLength(t *testing.T) {
+	input := "Content-Type: application/vscode-jsonrpc\r\n\r\n{}"
+	if _, err := lsp.ReadMessage(bufio.NewReader(strings.NewReader(input))); err == nil {
+		t.Fatalf("expected an error for a message without Content-Length")
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	code, messages := run(t, initialize, initialized, shutdown, exit)
+	if code != 0 {
+		t.Fatalf("expected exit code 0 after shutdown, got %d", code)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 responses, got %d", len(messages))
+	}
+
+	capabilities := messages[0]["result"].(map[string]any)["capabilities"].(map[string]any)
+	sync := capabilities["textDocumentSync"].(map[string]any)
+	if sync["openClose"] != true || sync["change"] != float64(lsp.SyncFull) {
+		t.Errorf("unexpected textDocumentSync capability %v", sync)
+	}
+
+	result, exists := messages[1]["result"]
+	if !exists || result != nil {
+		t.Errorf("expected shutdown to answer with a null result, got %v", messages[1])
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	code, _ := run(t, initialize, initialized, exit)
+	if code != 1 {
+		t.Fatalf("expected exit code 1 without shutdown, got %d", code)
+	}
+}
+
+func TestRequestBeforeInitialize(t *testing.T) {
+	_, messages := run(t, shutdown)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 response, got %d", len(messages))
+	}
+	err := messages[0]["error"].(map[string]any)
+	if err["code"] != float64(lsp.ServerNotInitialized) {
+		t.Errorf("expected ServerNotInitialized, got %v", err)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	_, messages := run(t, initialize, `{"jsonrpc":"2.0","id":7,"method":"pbls/unknown"}`)
+	err := messages[1]["error"].(map[string]any)
+	if err["code"] != float64(lsp.MethodNotFound) {
+		t.Errorf("expected MethodNotFound, got %v", err)
+	}
+}
+
+func didOpen(uri, text string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":%q,"languageId":"powerbuilder","version":1,"text":%q}}}`, uri, text)
+}
+
+func TestDocumentWithSyntaxErrorDoesNotStopServer(t *testing.T) {
+	code, messages := run(t, initialize, initialized, didOpen("file:///a.lang", "string = = ;"), shutdown, exit)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("expected 2 responses and 1 notification, got %d messages", len(messages))
+	}
+}
+
+func TestPublishDiagnostics(t *testing.T) {
+	_, messages := run(t, initialize, initialized, didOpen("file:///a.lang", "int li_a = 1\nstring ls_str = ;"))
+	if len(messages) != 2 || messages[1]["method"] != "textDocument/publishDiagnostics" {
+		t.Fatalf("expected a publishDiagnostics notification, got %v", messages)
+	}
+
+	params := messages[1]["params"].(map[string]any)
+	diagnostics := params["diagnostics"].([]any)
+	if params["uri"] != "file:///a.lang" || len(diagnostics) != 1 {
+		t.Fatalf("unexpected diagnostics %v", params)
+	}
+	d := diagnostics[0].(map[string]any)
+	start := d["range"].(map[string]any)["start"].(map[string]any)
+	if d["severity"] != float64(1) || d["source"] != "pbls" || start["line"] != float64(1) {
+		t.Errorf("unexpected diagnostic %v", d)
+	}
+}
+
+func TestDiagnosticPositionsCountUTF16(t *testing.T) {
+	cases := map[string]float64{
+		"int li_a = 1\nls = \"äöü\" + @": 13,
+		"int li_a = 1\nls = \"😀\" + @":   12,
+	}
+	for text, character := range cases {
+		_, messages := run(t, initialize, initialized, didOpen("file:///a.lang", text))
+		diagnostics := messages[1]["params"].(map[string]any)["diagnostics"].([]any)
+		if len(diagnostics) == 0 {
+			t.Fatalf("%q: expected a diagnostic", text)
+		}
+		r := diagnostics[0].(map[string]any)["range"].(map[string]any)
+		start, end := r["start"].(map[string]any), r["end"].(map[string]any)
+		if start["line"] != float64(1) || start["character"] != character || end["character"] != character+1 {
+			t.Errorf("%q: expected the diagnostic at 1:%v, got %v", text, character, r)
+		}
+	}
+}
+
+func TestDidCloseClearsDiagnostics(t *testing.T) {
+	didClose := `{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":"file:///a.lang"}}}`
+	_, messages := run(t, initialize, initialized, didOpen("file:///a.lang", "string = ;"), didClose)
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(messages))
+	}
+	params := messages[2]["params"].(map[string]any)
+	if diagnostics := params["diagnostics"].([]any); len(diagnostics) != 0 {
+		t.Errorf("expected diagnostics to be cleared, got %v", diagnostics)
+	}
+}
+
+func TestExportedObjectIsParsedAsSourceFile(t *testing.T) {
+	text := "$PBExportHeader$w_main.srw\nforward\nglobal type w_main from window\nend type\nend forward\n"
+	_, messages := run(t, initialize, initialized, didOpen("file:///C:/app/w_main.srw", text))
+	params := messages[1]["params"].(map[string]any)
+	if diagnostics := params["diagnostics"].([]any); len(diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %v", diagnostics)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	text := `global type n_cst_timer from nonvisualobject
+end type
+type prototypes
+function long MessageBoxW(long hwnd, string text, string title, uint flags) throws RuntimeError library "C:\Windows\System32\user32.dll" alias for "MessageBoxW"
+end prototypes
+forward prototypes
+public function long of_elapsed (ref long al_ticks[])
+end prototypes
+public function long of_elapsed (ref long al_ticks[]);return 0
+end function
+`
+	request := `{"jsonrpc":"2.0","id":3,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"file:///n_cst_timer.sru"}}}`
+	_, messages := run(t, initialize, initialized, didOpen("file:///n_cst_timer.sru", text), request)
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 messages, got %v", messages)
+	}
+
+	symbols := messages[2]["result"].([]any)
+	if len(symbols) != 3 {
+		t.Fatalf("expected the type and 2 functions, got %v", symbols)
+	}
+	external := symbols[1].(map[string]any)
+	if external["name"] != "MessageBoxW" || external["kind"] != float64(lsp.SymbolFunction) ||
+		external["detail"] != `function long MessageBoxW(long hwnd, string text, string title, unsignedinteger flags) throws RuntimeError library "C:\Windows\System32\user32.dll" alias for "MessageBoxW"` {
+		t.Errorf("unexpected external function symbol %v", external)
+	}
+	if function := symbols[2].(map[string]any); function["detail"] != "function long of_elapsed(ref long al_ticks[])" {
+		t.Errorf("unexpected function symbol %v", function)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"pbls/src/ast"
+	"pbls/src/diagnostic"
 	"pbls/src/lexer"
 	"pbls/src/parser"
 	"reflect"
@@ -25,16 +26,34 @@ func compareAst(t *testing.T, errMsg string, expected, actual ast.BlockStmt) {
 }
 
 func parse(statement string) ast.BlockStmt {
-	return parser.Parse(lexer.Tokenize([]byte(statement)))
+	program, _ := parseWithDiagnostics(statement)
+	return program
+}
+
+func parseWithDiagnostics(statement string) (ast.BlockStmt, []diagnostic.Diagnostic) {
+	tokens, lexDiagnostics := lexer.Tokenize([]byte(statement))
+	program, parseDiagnostics := parser.Parse(tokens)
+	return program, append(lexDiagnostics, parseDiagnostics...)
+}
+
+// span builds the span of a node on the first line, where columns are offsets + 1.
+func span(startOffset, endOffset int) ast.Span {
+	return ast.Span{
+		Start: ast.Position{Line: 1, Column: startOffset + 1, Offset: startOffset},
+		End:   ast.Position{Line: 1, Column: endOffset + 1, Offset: endOffset},
+	}
 }
 
 func TestSimpleVariableDeclaration(t *testing.T) {
 	expected := ast.BlockStmt{
+		Span: span(0, 27),
 		Body: []ast.Stmt{ast.VarDeclStmt{
+			Span:          span(0, 26),
 			Identifier:    "ls_string",
 			IsConstant:    false,
-			AssignedValue: ast.StringExpr{Value: "A B C"},
+			AssignedValue: ast.StringExpr{Span: span(19, 26), Value: "A B C", Raw: "A B C"},
 			ExplicitType: ast.SymbolType{
+				Span: span(0, 6),
 				Name: "string",
 			},
 		}},
@@ -44,22 +63,28 @@ func TestSimpleVariableDeclaration(t *testing.T) {
 }
 func TestMultiVariableDeclaration(t *testing.T) {
 	expected := ast.BlockStmt{
+		Span: span(0, 30),
 		Body: []ast.Stmt{
 			ast.MultiVarDeclStmt{
+				Span: span(0, 29),
 				Stmts: []ast.VarDeclStmt{
 					{
+						Span:          span(0, 17),
 						Identifier:    "ls_string1",
 						IsConstant:    false,
 						AssignedValue: nil,
 						ExplicitType: ast.SymbolType{
+							Span: span(0, 6),
 							Name: "string",
 						},
 					},
 					{
+						Span:          span(19, 29),
 						Identifier:    "ls_string2",
 						IsConstant:    false,
 						AssignedValue: nil,
 						ExplicitType: ast.SymbolType{
+							Span: span(0, 6),
 							Name: "string",
 						},
 					},
@@ -72,19 +97,1049 @@ func TestMultiVariableDeclaration(t *testing.T) {
 }
 func TestVarDeclExprStmt(t *testing.T) {
 	expected := ast.BlockStmt{
+		Span: span(0, 24),
 		Body: []ast.Stmt{
 			ast.VarDeclStmt{
+				Span:       span(0, 23),
 				Identifier: "ls_str",
 				IsConstant: false,
 				AssignedValue: ast.BinaryExpr{
-					Left:     ast.StringExpr{Value: "A"},
-					Operator: lexer.Token{Kind: lexer.PLUS, Value: "+", Line: 1, Column: 20},
-					Right:    ast.StringExpr{Value: "B"},
+					Span:     span(16, 23),
+					Left:     ast.StringExpr{Span: span(16, 19), Value: "A", Raw: "A"},
+					Operator: lexer.Token{Kind: lexer.PLUS, Value: "+", Line: 1, Column: 20, Offset: 19},
+					Right:    ast.StringExpr{Span: span(20, 23), Value: "B", Raw: "B"},
 				},
-				ExplicitType: ast.SymbolType{Name: "string"},
+				ExplicitType: ast.SymbolType{Span: span(0, 6), Name: "string"},
 			},
 		},
 	}
 	actual := parse("string ls_str = \"A\"+\"B\";")
 	compareAst(t, "Cannot parse Variable declaration with simple expression!", expected, actual)
 }
+func TestSyntaxErrorIsReported(t *testing.T) {
+	_, diagnostics := parseWithDiagnostics("string ls_str = ;")
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(diagnostics))
+	}
+	d := diagnostics[0]
+	if d.Code != diagnostic.ExpectedExpr || d.Severity != diagnostic.Error {
+		t.Errorf("unexpected diagnostic %v", d)
+	}
+	if d.StartLine != 1 || d.StartColumn != 17 || d.EndColumn != 18 {
+		t.Errorf("unexpected diagnostic position %d:%d-%d", d.StartLine, d.StartColumn, d.EndColumn)
+	}
+}
+func TestMissingExpressionReportedOnce(t *testing.T) {
+	cases := map[string]int{
+		"if a = then\nend if\n":     8,
+		"for i = to 10\nnext\n":     9,
+		"f(a, )\n":                  6,
+		"x = (a + )\n":              10,
+		"x = {1, }\n":               9,
+		"for i = 1 to 9 step\nnext": 20,
+	}
+	for source, column := range cases {
+		_, diagnostics := parseWithDiagnostics(source)
+		if len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.ExpectedExpr || diagnostics[0].StartColumn != column {
+			t.Errorf("%q: expected one diagnostic at column %d, got %v", source, column, diagnostics)
+		}
+	}
+}
+func TestRecoveryAfterSyntaxErrors(t *testing.T) {
+	source := "string ls_a = \"ok\"\n" +
+		"int li_b = )\n" +
+		"long = 5\n" +
+		"string ls_c, 5\n" +
+		"int li_d = 4\n"
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+	for i, line := range []int{2, 3, 4} {
+		if diagnostics[i].StartLine != line {
+			t.Errorf("expected diagnostic %d on line %d, got %d", i, line, diagnostics[i].StartLine)
+		}
+	}
+	if len(program.Body) != 5 {
+		t.Fatalf("expected 5 statements, got %d", len(program.Body))
+	}
+
+	if decl, ok := program.Body[1].(ast.VarDeclStmt); !ok || reflect.TypeOf(decl.AssignedValue) != reflect.TypeOf(ast.BadExpr{}) {
+		t.Errorf("expected a declaration with a BadExpr value, got %#v", program.Body[1])
+	}
+	for _, i := range []int{2, 3} {
+		if _, ok := program.Body[i].(ast.BadStmt); !ok {
+			t.Errorf("expected statement %d to be a BadStmt, got %#v", i, program.Body[i])
+		}
+	}
+	if decl, ok := program.Body[4].(ast.VarDeclStmt); !ok || decl.Identifier != "li_d" {
+		t.Errorf("expected parsing to continue after the errors, got %#v", program.Body[4])
+	}
+
+	// Each mistake is reported once, without errors following from it.
+	program, diagnostics = parseWithDiagnostics("x = = 1\ny = 2\nz = * 3\nw = 4\nfoo(\nv = 5\n")
+	if len(diagnostics) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+	for i, line := range []int{1, 3, 5} {
+		if diagnostics[i].StartLine != line || diagnostics[i].Code != diagnostic.ExpectedExpr {
+			t.Errorf("expected diagnostic %d on line %d, got %v", i, line, diagnostics[i])
+		}
+	}
+	if len(program.Body) != 6 {
+		t.Fatalf("expected 6 statements, got %d", len(program.Body))
+	}
+}
+func TestIncompleteExpressions(t *testing.T) {
+	for _, source := range []string{"x = 1 +", "ls_y =", "return -", "ls = not", "a = b and", "choose case a\ncase \nend choose", "do while i <\nloop"} {
+		_, diagnostics := parseWithDiagnostics(source)
+		if len(diagnostics) != 1 || diagnostics[0].Code != diagnostic.ExpectedExpr {
+			t.Errorf("%q: expected a single missing expression, got %v", source, diagnostics)
+		}
+	}
+}
+func TestIncompleteExpressionKeepsNextLine(t *testing.T) {
+	for _, source := range []string{"long ll = \nx = 1\n", "for i = 1 to\nx = 1\nnext\n"} {
+		program, diagnostics := parseWithDiagnostics(source)
+		if len(diagnostics) != 1 || diagnostics[0].StartLine != 1 {
+			t.Errorf("%q: expected a single diagnostic on line 1, got %v", source, diagnostics)
+		}
+		var body []ast.Stmt
+		switch stmt := program.Body[0].(type) {
+		case ast.ForStmt:
+			body = stmt.Body.Body
+		default:
+			body = program.Body[1:]
+		}
+		if len(body) != 1 || reflect.TypeOf(body[0]) != reflect.TypeOf(ast.AssignStmt{}) {
+			t.Errorf("%q: expected the assignment on line 2 to be kept, got %#v", source, program.Body)
+		}
+	}
+}
+func TestSpansAcrossLines(t *testing.T) {
+	program := parse("int li_a = 1\nlong ll_b = li_a + 2\n")
+	decl, ok := program.Body[1].(ast.VarDeclStmt)
+	if !ok {
+		t.Fatalf("expected a declaration, got %#v", program.Body[1])
+	}
+	expected := ast.Span{
+		Start: ast.Position{Line: 2, Column: 1, Offset: 13},
+		End:   ast.Position{Line: 2, Column: 21, Offset: 33},
+	}
+	if decl.Range() != expected {
+		t.Errorf("expected declaration span %v, got %v", expected, decl.Range())
+	}
+	value := decl.AssignedValue.(ast.BinaryExpr)
+	if value.Left.Range().Start.Column != 13 || value.Right.Range().End.Column != 21 {
+		t.Errorf("unexpected expression span %v", value.Range())
+	}
+}
+func TestGroupingSpanIncludesParentheses(t *testing.T) {
+	program := parse("x = (a + b) * 2\n")
+	product := program.Body[0].(ast.AssignStmt).Value.(ast.BinaryExpr)
+	group, ok := product.Left.(ast.GroupingExpr)
+	if !ok || group.Range() != span(4, 11) || group.Value.Range() != span(5, 10) {
+		t.Errorf("unexpected grouping %#v", product.Left)
+	}
+	if product.Range() != span(4, 15) {
+		t.Errorf("unexpected product span %v", product.Range())
+	}
+}
+func TestTypeNamesIgnoreCase(t *testing.T) {
+	program := parse("Long ll_row\nSTRING ls_a\n")
+	for i, name := range []string{"long", "string"} {
+		decl := program.Body[i].(ast.VarDeclStmt)
+		if decl.ExplicitType.(ast.SymbolType).Name != name {
+			t.Errorf("expected type %s, got %#v", name, decl.ExplicitType)
+		}
+	}
+}
+func TestBuiltinTypeAliases(t *testing.T) {
+	source := "int li_a\ncharacter lc_b\ndec ldc_c\nuint lui_d\nulong lul_e\nboolean lb_f\n"
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	for i, name := range []string{"integer", "char", "decimal", "unsignedinteger", "unsignedlong", "boolean"} {
+		decl := program.Body[i].(ast.VarDeclStmt)
+		if decl.ExplicitType.(ast.SymbolType).Name != name {
+			t.Errorf("expected type %s, got %#v", name, decl.ExplicitType)
+		}
+	}
+}
+func TestIfElseIfElseBlock(t *testing.T) {
+	source := `if ll_row <= 0 then
+	int li_a = 1
+elseif ll_row > 10 then
+	int li_b = 2
+	int li_c = 3
+else
+	int li_d = 4
+end if
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if len(program.Body) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(program.Body))
+	}
+
+	stmt := program.Body[0].(ast.IfStmt)
+	if stmt.SingleLine || len(stmt.Consequent.Body) != 1 {
+		t.Fatalf("unexpected if statement %#v", stmt)
+	}
+	if stmt.Range().End.Line != 8 {
+		t.Errorf("expected the if statement to end on line 8, got %v", stmt.Range())
+	}
+	elseIf, ok := stmt.Alternate.(ast.IfStmt)
+	if !ok || len(elseIf.Consequent.Body) != 2 {
+		t.Fatalf("expected an elseif branch with 2 statements, got %#v", stmt.Alternate)
+	}
+	elseBlock, ok := elseIf.Alternate.(ast.BlockStmt)
+	if !ok || len(elseBlock.Body) != 1 {
+		t.Fatalf("expected an else branch with 1 statement, got %#v", elseIf.Alternate)
+	}
+}
+func TestSingleLineIf(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics("if ll_row <= 0 then ll_row else 5\nint li_a\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if len(program.Body) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Body))
+	}
+
+	stmt := program.Body[0].(ast.IfStmt)
+	if !stmt.SingleLine || len(stmt.Consequent.Body) != 1 {
+		t.Fatalf("unexpected if statement %#v", stmt)
+	}
+	alternate := stmt.Alternate.(ast.BlockStmt).Body[0].(ast.ExprStmt)
+	if alternate.Expr.(ast.NumberExpr).Value != 5 {
+		t.Errorf("unexpected else branch %#v", alternate)
+	}
+}
+func TestIfWithoutEndIf(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics("if a then\n\tint li_a = 1\n")
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %v", diagnostics)
+	}
+	if stmt, ok := program.Body[0].(ast.IfStmt); !ok || len(stmt.Consequent.Body) != 1 {
+		t.Errorf("expected the if statement to be kept, got %#v", program.Body[0])
+	}
+}
+func TestCallAndMemberExpressions(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics("this.getitemstring( ll_row, 'sperre_vfa')\ncanedit(false, c.s_upd_forbid_info + c.s_info)\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	call := program.Body[0].(ast.ExprStmt).Expr.(ast.CallExpr)
+	method := call.Method.(ast.MemberExpr)
+	if method.Member.(ast.SymbolExpr).Value != "this" || method.Property != "getitemstring" {
+		t.Errorf("unexpected method %#v", call.Method)
+	}
+	if len(call.Arguments) != 2 || call.Arguments[1].(ast.StringExpr).Value != "sperre_vfa" {
+		t.Errorf("unexpected arguments %#v", call.Arguments)
+	}
+	if call.Range() != span(0, 41) {
+		t.Errorf("unexpected call span %v", call.Range())
+	}
+
+	call = program.Body[1].(ast.ExprStmt).Expr.(ast.CallExpr)
+	if len(call.Arguments) != 2 || call.Arguments[0] != (ast.BooleanExpr{Span: call.Arguments[0].Range(), Value: false}) {
+		t.Errorf("unexpected arguments %#v", call.Arguments)
+	}
+	sum := call.Arguments[1].(ast.BinaryExpr)
+	if sum.Left.(ast.MemberExpr).Property != "s_upd_forbid_info" {
+		t.Errorf("unexpected argument %#v", sum)
+	}
+}
+func TestMemberAndIndexChain(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics("dw_1.Object.col[1]\nli_grid[i, j + 1]\nthis.Control[]\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	index := program.Body[0].(ast.ExprStmt).Expr.(ast.IndexExpr)
+	col := index.Member.(ast.MemberExpr)
+	object := col.Member.(ast.MemberExpr)
+	if col.Property != "col" || object.Property != "Object" || object.Member.(ast.SymbolExpr).Value != "dw_1" {
+		t.Errorf("unexpected member chain %#v", index.Member)
+	}
+	if len(index.Indexes) != 1 || index.Indexes[0].(ast.NumberExpr).Value != 1 {
+		t.Errorf("unexpected indexes %#v", index.Indexes)
+	}
+
+	if index := program.Body[1].(ast.ExprStmt).Expr.(ast.IndexExpr); len(index.Indexes) != 2 {
+		t.Errorf("expected 2 indexes, got %#v", index.Indexes)
+	}
+	if index := program.Body[2].(ast.ExprStmt).Expr.(ast.IndexExpr); len(index.Indexes) != 0 {
+		t.Errorf("expected no indexes, got %#v", index.Indexes)
+	}
+}
+func TestKeywordsAsMemberNames(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics("dw_1.Update()\nOpen(w_main)\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	call := program.Body[0].(ast.ExprStmt).Expr.(ast.CallExpr)
+	if call.Method.(ast.MemberExpr).Property != "Update" {
+		t.Errorf("unexpected method %#v", call.Method)
+	}
+	call = program.Body[1].(ast.ExprStmt).Expr.(ast.CallExpr)
+	if call.Method.(ast.SymbolExpr).Value != "Open" {
+		t.Errorf("unexpected method %#v", call.Method)
+	}
+}
+func TestControlFlowStatements(t *testing.T) {
+	source := `if ll_row <= 0 then return 0
+return
+exit
+continue
+halt
+HALT CLOSE
+goto lbl_end
+lbl_end:
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if len(program.Body) != 8 {
+		t.Fatalf("expected 8 statements, got %d", len(program.Body))
+	}
+
+	ret := program.Body[0].(ast.IfStmt).Consequent.Body[0].(ast.ReturnStmt)
+	if ret.Value.(ast.NumberExpr).Value != 0 {
+		t.Errorf("unexpected return value %#v", ret.Value)
+	}
+	if ret := program.Body[1].(ast.ReturnStmt); ret.Value != nil {
+		t.Errorf("expected a return without value, got %#v", ret.Value)
+	}
+	if _, ok := program.Body[2].(ast.ExitStmt); !ok {
+		t.Errorf("expected an exit statement, got %#v", program.Body[2])
+	}
+	if _, ok := program.Body[3].(ast.ContinueStmt); !ok {
+		t.Errorf("expected a continue statement, got %#v", program.Body[3])
+	}
+	if halt := program.Body[4].(ast.HaltStmt); halt.Close {
+		t.Errorf("expected a plain halt, got %#v", halt)
+	}
+	if halt := program.Body[5].(ast.HaltStmt); !halt.Close {
+		t.Errorf("expected halt close, got %#v", halt)
+	}
+	if stmt := program.Body[6].(ast.GotoStmt); stmt.Label != "lbl_end" {
+		t.Errorf("unexpected goto %#v", stmt)
+	}
+	if stmt := program.Body[7].(ast.LabelStmt); stmt.Name != "lbl_end" {
+		t.Errorf("unexpected label %#v", stmt)
+	}
+}
+func TestExampleScript(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics(string(readFile("../../examples/01.lang")))
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if len(program.Body) != 8 {
+		t.Fatalf("expected 8 statements, got %d", len(program.Body))
+	}
+	if _, ok := program.Body[7].(ast.ReturnStmt); !ok {
+		t.Errorf("expected the script to end with a return, got %#v", program.Body[7])
+	}
+}
+func TestChooseCase(t *testing.T) {
+	source := `choose case ls_action
+	case "save", "close"
+		int li_a = 1
+	case 10 to 20
+	case is > 100
+		int li_b = 2
+		int li_c = 3
+	case else
+		return 0
+end choose
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	stmt := program.Body[0].(ast.ChooseCaseStmt)
+	if stmt.Subject.(ast.SymbolExpr).Value != "ls_action" || len(stmt.Cases) != 4 {
+		t.Fatalf("unexpected choose case %#v", stmt)
+	}
+	if stmt.Range().End.Line != 10 {
+		t.Errorf("expected the statement to end on line 10, got %v", stmt.Range())
+	}
+
+	values := stmt.Cases[0].Conditions
+	if len(values) != 2 || values[1].(ast.CaseValue).Value.(ast.StringExpr).Value != "close" {
+		t.Errorf("unexpected conditions %#v", values)
+	}
+	between := stmt.Cases[1].Conditions[0].(ast.CaseRange)
+	if between.From.(ast.NumberExpr).Value != 10 || between.To.(ast.NumberExpr).Value != 20 {
+		t.Errorf("unexpected range %#v", between)
+	}
+	if len(stmt.Cases[1].Body.Body) != 0 {
+		t.Errorf("expected an empty case, got %#v", stmt.Cases[1].Body)
+	}
+	is := stmt.Cases[2].Conditions[0].(ast.CaseIs)
+	if is.Operator.Kind != lexer.GREATER || is.Value.(ast.NumberExpr).Value != 100 || len(stmt.Cases[2].Body.Body) != 2 {
+		t.Errorf("unexpected case %#v", stmt.Cases[2])
+	}
+	if !stmt.Cases[3].IsElse || len(stmt.Cases[3].Conditions) != 0 {
+		t.Errorf("expected case else, got %#v", stmt.Cases[3])
+	}
+}
+func TestForNext(t *testing.T) {
+	source := `for li_i = 1 to ll_count step -1
+	li_sum = li_sum + li_i
+next
+FOR li_j = 1 TO 10
+NEXT
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	stmt := program.Body[0].(ast.ForStmt)
+	if stmt.Variable.(ast.SymbolExpr).Value != "li_i" || stmt.From.(ast.NumberExpr).Value != 1 {
+		t.Errorf("unexpected loop header %#v", stmt)
+	}
+	if stmt.To.(ast.SymbolExpr).Value != "ll_count" || stmt.Step.(ast.PrefixExpr).Operator.Kind != lexer.MINUS {
+		t.Errorf("unexpected loop bounds %#v", stmt)
+	}
+	if len(stmt.Body.Body) != 1 || stmt.Range().End.Line != 3 {
+		t.Errorf("unexpected loop body %#v", stmt.Body)
+	}
+	if stmt := program.Body[1].(ast.ForStmt); stmt.Step != nil || len(stmt.Body.Body) != 0 {
+		t.Errorf("unexpected loop %#v", stmt)
+	}
+}
+func TestDoLoopVariants(t *testing.T) {
+	source := `do while li_i < 10
+	li_i = li_i + 1
+loop
+do until li_i > 10
+loop
+do
+loop while li_i < 10
+do
+	exit
+loop until li_i > 10
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	expected := []struct{ until, testAtEnd bool }{{false, false}, {true, false}, {false, true}, {true, true}}
+	for i, e := range expected {
+		stmt := program.Body[i].(ast.DoLoopStmt)
+		if stmt.Until != e.until || stmt.TestAtEnd != e.testAtEnd || stmt.Condition == nil {
+			t.Errorf("unexpected loop %d: %#v", i, stmt)
+		}
+	}
+	if stmt := program.Body[3].(ast.DoLoopStmt); len(stmt.Body.Body) != 1 || stmt.Range().End.Line != 10 {
+		t.Errorf("unexpected loop body %#v", stmt)
+	}
+}
+func TestLoopWithoutClosingKeyword(t *testing.T) {
+	cases := map[string]string{
+		"if lb_ok then\n\tfor li_i = 1 to 3\n\t\tof_x(li_i)\nend if\n": "Expected 'next' but got 'end'",
+		"if lb_ok then\n\tdo while li_i < 3\n\t\tli_i++\nend if\n":     "Expected 'loop' but got 'end'",
+	}
+	for source, message := range cases {
+		program, diagnostics := parseWithDiagnostics(source)
+		if len(diagnostics) != 1 || diagnostics[0].Message != message || diagnostics[0].StartLine != 4 {
+			t.Errorf("%q: expected %q on line 4, got %v", source, message, diagnostics)
+		}
+		stmt, ok := program.Body[0].(ast.IfStmt)
+		if len(program.Body) != 1 || !ok || len(stmt.Consequent.Body) != 1 {
+			t.Errorf("%q: expected the loop inside a closed IF, got %#v", source, program.Body)
+		}
+	}
+}
+func TestTryCatchFinally(t *testing.T) {
+	source := `try
+	of_save()
+catch (RuntimeError lre_error)
+	return -1
+catch (Exception le_error)
+	throw le_error
+finally
+	of_cleanup()
+end try
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	stmt := program.Body[0].(ast.TryStmt)
+	if len(stmt.Body.Body) != 1 || len(stmt.Catches) != 2 || stmt.Finally == nil {
+		t.Fatalf("unexpected try statement %#v", stmt)
+	}
+	first := stmt.Catches[0]
+	if first.ExceptionType.(ast.SymbolType).Name != "RuntimeError" || first.Identifier != "lre_error" {
+		t.Errorf("unexpected catch clause %#v", first)
+	}
+	throw := stmt.Catches[1].Body.Body[0].(ast.ThrowStmt)
+	if throw.Value.(ast.SymbolExpr).Value != "le_error" {
+		t.Errorf("unexpected throw %#v", throw)
+	}
+	if len(stmt.Finally.Body) != 1 || stmt.Range().End.Line != 9 {
+		t.Errorf("unexpected finally block %#v", stmt.Finally)
+	}
+}
+func TestTryWithoutFinally(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics("try\n\tof_save()\ncatch (Exception e)\nend try\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if stmt := program.Body[0].(ast.TryStmt); stmt.Finally != nil || len(stmt.Catches) != 1 {
+		t.Errorf("unexpected try statement %#v", stmt)
+	}
+}
+
+func TestFunctionDecl(t *testing.T) {
+	source := `public function integer of_foo (string as_arg, ref long al_out, readonly string as_names[]) throws Exception;long ll_count
+al_out = ll_count
+return 1
+end function
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	decl := program.Body[0].(ast.FunctionDecl)
+	if decl.Access != ast.PublicAccess || decl.Name != "of_foo" || decl.ReturnType.(ast.SymbolType).Name != "integer" {
+		t.Errorf("unexpected function signature %#v", decl)
+	}
+	if len(decl.Params) != 3 || len(decl.Throws) != 1 || decl.Body == nil || len(decl.Body.Body) != 3 {
+		t.Fatalf("unexpected function declaration %#v", decl)
+	}
+	if !decl.Params[1].ByRef || decl.Params[1].Name != "al_out" {
+		t.Errorf("expected a by-reference parameter, got %#v", decl.Params[1])
+	}
+	if array, ok := decl.Params[2].Type.(ast.ArrayType); !ok || !decl.Params[2].ReadOnly || array.Underlying.(ast.SymbolType).Name != "string" {
+		t.Errorf("expected a readonly array parameter, got %#v", decl.Params[2])
+	}
+	if decl.Range().End.Line != 4 {
+		t.Errorf("expected the function to end on line 4, got %v", decl.Range())
+	}
+}
+
+func TestSubroutineAndPrototype(t *testing.T) {
+	source := "private subroutine of_reset ()\nsubroutine of_reset ();ii_count = 0\nend subroutine\n"
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	prototype := program.Body[0].(ast.FunctionDecl)
+	if !prototype.IsSubroutine || prototype.Access != ast.PrivateAccess || prototype.Body != nil {
+		t.Errorf("unexpected prototype %#v", prototype)
+	}
+	if script := program.Body[1].(ast.FunctionDecl); script.ReturnType != nil || script.Body == nil || len(script.Body.Body) != 1 {
+		t.Errorf("unexpected subroutine %#v", script)
+	}
+}
+
+func TestEventDecl(t *testing.T) {
+	source := "event open;of_init()\nend event\nevent type long ue_save (string as_path)\n"
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	script := program.Body[0].(ast.EventDecl)
+	if script.Name != "open" || script.Body == nil || len(script.Body.Body) != 1 {
+		t.Errorf("unexpected event script %#v", script)
+	}
+	declaration := program.Body[1].(ast.EventDecl)
+	if declaration.ReturnType.(ast.SymbolType).Name != "long" || len(declaration.Params) != 1 || declaration.Body != nil {
+		t.Errorf("unexpected event declaration %#v", declaration)
+	}
+}
+
+func TestExportedWindow(t *testing.T) {
+	tokens, _ := lexer.Tokenize(readFile("../../examples/w_main.srw"))
+	file, diagnostics := parser.ParseSourceFile(tokens)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if file.Header != "w_main.srw" || file.Comments != "Main window" {
+		t.Errorf("unexpected export header %q, comments %q", file.Header, file.Comments)
+	}
+	if len(file.Body) != 11 {
+		t.Fatalf("expected 11 top-level declarations, got %d", len(file.Body))
+	}
+
+	if forward := file.Body[0].(ast.ForwardDecl); len(forward.Body.Body) != 2 {
+		t.Errorf("expected 2 forward declarations, got %#v", forward)
+	}
+	window := file.Body[1].(ast.TypeDecl)
+	if !window.Global || window.Name != "w_main" || window.Ancestor.(ast.SymbolType).Name != "window" || len(window.Properties) != 6 {
+		t.Errorf("unexpected window type %#v", window)
+	}
+	if property := window.Properties[4]; property.AssignedValue.(ast.EnumExpr).Value != "main" {
+		t.Errorf("expected an enumerated value, got %#v", property.AssignedValue)
+	}
+	if variables := file.Body[3].(ast.VariablesDecl); variables.Scope != ast.InstanceScope || len(variables.Variables) != 1 {
+		t.Errorf("unexpected instance variables %#v", variables)
+	}
+	if prototypes := file.Body[4].(ast.PrototypesDecl); prototypes.Body.Body[0].(ast.FunctionDecl).Body != nil {
+		t.Errorf("expected a prototype without body, got %#v", prototypes)
+	}
+	create := file.Body[6].(ast.OnDecl)
+	if create.Object != "w_main" || create.Event != "create" || len(create.Body.Body) != 1 {
+		t.Errorf("unexpected on block %#v", create)
+	}
+	if _, ok := file.Body[7].(ast.OnDecl).Body.Body[0].(ast.DestroyStmt); !ok {
+		t.Errorf("expected a destroy statement, got %#v", file.Body[7])
+	}
+	if control := file.Body[9].(ast.TypeDecl); control.Global || control.Within.(ast.SymbolType).Name != "w_main" {
+		t.Errorf("unexpected control type %#v", control)
+	}
+}
+
+func TestUnclosedBlockInScript(t *testing.T) {
+	for _, block := range []string{"if ab_ok then", "choose case ab_ok\ncase true", "try"} {
+		source := "global type w_main from window\nend type\n\n" +
+			"public function long of_a (boolean ab_ok);" + block + "\n\treturn 1\nreturn 0\nend function\n\n" +
+			"public function long of_b ();return 2\nend function\n\n" +
+			"event open;of_a(true)\nend event\n"
+		tokens, _ := lexer.Tokenize([]byte(source))
+		file, diagnostics := parser.ParseSourceFile(tokens)
+		if len(diagnostics) != 1 {
+			t.Errorf("%q: expected the missing end to be the only diagnostic, got %v", block, diagnostics)
+		}
+		if len(file.Body) != 4 {
+			t.Fatalf("%q: expected 4 top-level declarations, got %d", block, len(file.Body))
+		}
+		if of_b, ok := file.Body[2].(ast.FunctionDecl); !ok || of_b.Name != "of_b" {
+			t.Errorf("%q: expected of_b at top level, got %#v", block, file.Body[2])
+		}
+		if open, ok := file.Body[3].(ast.EventDecl); !ok || open.Name != "open" || len(open.Body.Body) != 1 {
+			t.Errorf("%q: expected the open event at top level, got %#v", block, file.Body[3])
+		}
+	}
+}
+
+func TestCreateUsing(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics("n_cst_service lnv_service\nlnv_service = create using ls_class\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if decl := program.Body[0].(ast.VarDeclStmt); decl.ExplicitType.(ast.SymbolType).Name != "n_cst_service" {
+		t.Errorf("unexpected declaration %#v", decl)
+	}
+	assignment := program.Body[1].(ast.AssignStmt)
+	if create := assignment.Value.(ast.CreateExpr); create.Type != nil || create.Using.(ast.SymbolExpr).Value != "ls_class" {
+		t.Errorf("unexpected create expression %#v", create)
+	}
+}
+
+func TestTypeDeclMembers(t *testing.T) {
+	source := `global type n_cst_service from nonvisualobject autoinstantiate
+descriptor "pb_nvo" = "true"
+boolean ib_ready = true
+string is_first, is_second
+event ue_keydown pbm_keydown
+event type long ue_load ( string as_name )
+end type
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	decl := program.Body[0].(ast.TypeDecl)
+	if !decl.AutoInstantiate || decl.Within != nil || decl.Range().End.Line != 7 {
+		t.Errorf("unexpected type declaration %#v", decl)
+	}
+	if len(decl.Descriptors) != 1 || decl.Descriptors[0].Name != "pb_nvo" || decl.Descriptors[0].Value != "true" {
+		t.Errorf("unexpected descriptors %#v", decl.Descriptors)
+	}
+	if len(decl.Properties) != 3 || decl.Properties[2].Identifier != "is_second" {
+		t.Errorf("unexpected properties %#v", decl.Properties)
+	}
+	if len(decl.Events) != 2 || decl.Events[0].EventID != "pbm_keydown" || len(decl.Events[1].Params) != 1 {
+		t.Errorf("unexpected events %#v", decl.Events)
+	}
+}
+
+func TestStatementInTypeDecl(t *testing.T) {
+	_, diagnostics := parseWithDiagnostics("type u_base from userobject\nreturn 1\nend type\n")
+	if len(diagnostics) != 1 || diagnostics[0].StartLine != 2 {
+		t.Errorf("expected a diagnostic for the statement on line 2, got %v", diagnostics)
+	}
+}
+
+func TestVariableSections(t *testing.T) {
+	source := `type variables
+long il_count
+public:
+	string is_name, is_title
+	privatewrite boolean ib_dirty
+private:
+	protected constant integer ii_max = 10
+end variables
+global variables
+transaction itr_main
+end variables
+shared variables
+long sl_instances
+end variables
+global w_main w_main
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	instance := program.Body[0].(ast.VariablesDecl).Variables
+	if len(instance) != 5 {
+		t.Fatalf("expected 5 instance variables, got %#v", instance)
+	}
+	for _, variable := range instance {
+		if variable.Scope != ast.InstanceScope {
+			t.Errorf("expected instance scope for %s, got %d", variable.Identifier, variable.Scope)
+		}
+	}
+	if instance[0].Access != ast.DefaultAccess || instance[2].Access != ast.PublicAccess {
+		t.Errorf("expected the label to apply to the declarations after it, got %#v", instance)
+	}
+	if dirty := instance[3]; dirty.Access != ast.PublicAccess || dirty.WriteAccess != ast.PrivateAccess {
+		t.Errorf("unexpected modifiers %#v", dirty)
+	}
+	if limit := instance[4]; limit.Access != ast.ProtectedAccess || !limit.IsConstant {
+		t.Errorf("expected an explicit access to win over the label, got %#v", limit)
+	}
+
+	if global := program.Body[1].(ast.VariablesDecl).Variables[0]; global.Scope != ast.GlobalScope || global.ExplicitType.(ast.SymbolType).Name != "transaction" {
+		t.Errorf("unexpected global variable %#v", global)
+	}
+	if shared := program.Body[2].(ast.VariablesDecl).Variables[0]; shared.Scope != ast.SharedScope {
+		t.Errorf("unexpected shared variable %#v", shared)
+	}
+	if window := program.Body[3].(ast.VarDeclStmt); window.Scope != ast.GlobalScope || window.Range().Start.Column != 1 {
+		t.Errorf("unexpected global declaration %#v", window)
+	}
+}
+
+func TestLocalVariableScope(t *testing.T) {
+	program := parse("long ll_row\n")
+	if decl := program.Body[0].(ast.VarDeclStmt); decl.Scope != ast.LocalScope || decl.Access != ast.DefaultAccess {
+		t.Errorf("expected a local variable, got %#v", decl)
+	}
+}
+
+func TestArrayDeclarations(t *testing.T) {
+	source := `long ll_ids[]
+integer li_grid[1 to 10, 1 to 5]
+string ls_names[5], ls_single
+integer li_values[] = {1, 2, 3}
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	if ids := program.Body[0].(ast.VarDeclStmt).ExplicitType.(ast.ArrayType); len(ids.Dimensions) != 0 || ids.Underlying.(ast.SymbolType).Name != "long" {
+		t.Errorf("expected an unbounded array, got %#v", ids)
+	}
+	grid := program.Body[1].(ast.VarDeclStmt).ExplicitType.(ast.ArrayType)
+	if len(grid.Dimensions) != 2 || grid.Dimensions[1].Lower.(ast.NumberExpr).Value != 1 || grid.Dimensions[1].Upper.(ast.NumberExpr).Value != 5 {
+		t.Errorf("unexpected dimensions %#v", grid.Dimensions)
+	}
+
+	names := program.Body[2].(ast.MultiVarDeclStmt)
+	if bounded := names.Stmts[0].ExplicitType.(ast.ArrayType); bounded.Dimensions[0].Lower != nil || bounded.Dimensions[0].Upper.(ast.NumberExpr).Value != 5 {
+		t.Errorf("unexpected bounds %#v", bounded.Dimensions)
+	}
+	if _, ok := names.Stmts[1].ExplicitType.(ast.SymbolType); !ok {
+		t.Errorf("expected only the first variable to be an array, got %#v", names.Stmts[1].ExplicitType)
+	}
+
+	literal := program.Body[3].(ast.VarDeclStmt).AssignedValue.(ast.ArrayLiteralExpr)
+	if len(literal.Elements) != 3 || literal.Range().Start.Column != 23 || literal.Range().End.Column != 32 {
+		t.Errorf("unexpected array literal %#v", literal)
+	}
+}
+
+func TestInvalidConstants(t *testing.T) {
+	_, diagnostics := parseWithDiagnostics("constant long ll_max\nconstant long ll_ids[] = {1}\n")
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diagnostics)
+	}
+	if diagnostics[0].StartLine != 1 || diagnostics[1].StartLine != 2 || diagnostics[1].StartColumn != 21 {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+}
+
+func TestPrecisionTypes(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics("dec{4} ldc_rate\nblob{100} lb_data\ndecimal ldc_total\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	rate := program.Body[0].(ast.VarDeclStmt).ExplicitType.(ast.SymbolType)
+	if rate.Name != "decimal" || rate.Precision == nil || *rate.Precision != 4 || rate.Range() != span(0, 6) {
+		t.Errorf("unexpected decimal type %#v", rate)
+	}
+	if data := program.Body[1].(ast.VarDeclStmt).ExplicitType.(ast.SymbolType); data.Precision == nil || *data.Precision != 100 {
+		t.Errorf("unexpected blob type %#v", data)
+	}
+	if total := program.Body[2].(ast.VarDeclStmt).ExplicitType.(ast.SymbolType); total.Precision != nil {
+		t.Errorf("expected no precision, got %d", *total.Precision)
+	}
+}
+
+func TestPrecisionOnOtherTypes(t *testing.T) {
+	_, diagnostics := parseWithDiagnostics("long{2} ll_count\ndecimal{1.5} ldc_x\n")
+	if len(diagnostics) != 2 || diagnostics[0].StartColumn != 5 || diagnostics[1].StartColumn != 9 {
+		t.Errorf("expected a diagnostic for each invalid precision, got %v", diagnostics)
+	}
+}
+
+func TestExternalFunctions(t *testing.T) {
+	source := `type prototypes
+function ulong GetTickCount() library "kernel32.dll"
+function long MessageBoxW(long hwnd, string text, string title, uint flags) library "user32.dll" alias for "MessageBoxW"
+subroutine Sleep(ulong milliseconds) throws RuntimeError library "kernel32.dll"
+end prototypes
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	prototypes := program.Body[0].(ast.PrototypesDecl)
+	if !prototypes.External || len(prototypes.Body.Body) != 3 {
+		t.Fatalf("unexpected prototypes %#v", prototypes)
+	}
+	ticks := prototypes.Body.Body[0].(ast.ExternalFunctionDecl)
+	if ticks.Name != "GetTickCount" || ticks.Library != "kernel32.dll" || ticks.Alias != "" || ticks.ReturnType.(ast.SymbolType).Name != "unsignedlong" {
+		t.Errorf("unexpected external function %#v", ticks)
+	}
+	if box := prototypes.Body.Body[1].(ast.ExternalFunctionDecl); len(box.Params) != 4 || box.Alias != "MessageBoxW" || box.Range().End.Line != 3 {
+		t.Errorf("unexpected aliased function %#v", box)
+	}
+	if sleep := prototypes.Body.Body[2].(ast.ExternalFunctionDecl); !sleep.IsSubroutine || sleep.ReturnType != nil || len(sleep.Throws) != 1 {
+		t.Errorf("unexpected external subroutine %#v", sleep)
+	}
+}
+
+func TestInvocationKinds(t *testing.T) {
+	source := `event open;call super::open
+this.event ue_refresh()
+this.post event ue_load(1)
+dw_1.trigger event itemchanged(1, dwo, "x")
+lnv_service.dynamic of_refresh()
+super::event open()
+u_base::of_init()
+event ue_refresh()
+call w_base` + "`" + `cb_ok::clicked
+end event
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	body := program.Body[0].(ast.EventDecl).Body.Body
+	if len(body) != 9 {
+		t.Fatalf("expected 9 statements, got %d", len(body))
+	}
+	call := func(i int) ast.CallExpr {
+		return body[i].(ast.ExprStmt).Expr.(ast.CallExpr)
+	}
+
+	if stmt := body[0].(ast.CallStmt); stmt.Ancestor != "super" || stmt.Event != "open" || stmt.Control != "" {
+		t.Errorf("unexpected call statement %#v", stmt)
+	}
+	if refresh := call(1); !refresh.IsEvent || refresh.IsPost || refresh.Method.(ast.MemberExpr).Property != "ue_refresh" {
+		t.Errorf("unexpected event call %#v", refresh)
+	}
+	if load := call(2); !load.IsEvent || !load.IsPost || len(load.Arguments) != 1 || load.Range().End.Line != 3 {
+		t.Errorf("unexpected posted event %#v", load)
+	}
+	if changed := call(3); !changed.IsEvent || changed.IsPost || len(changed.Arguments) != 3 ||
+		len(changed.Qualifiers) != 2 || changed.Qualifiers[0].Kind != lexer.TRIGGER || changed.Qualifiers[1].Kind != lexer.EVENT {
+		t.Errorf("unexpected triggered event %#v", changed)
+	}
+	if dynamic := call(4); !dynamic.IsDynamic || dynamic.IsEvent {
+		t.Errorf("unexpected dynamic call %#v", dynamic)
+	}
+	if ancestor := call(5); ancestor.Ancestor != "super" || !ancestor.IsEvent || ancestor.Method.(ast.SymbolExpr).Value != "open" {
+		t.Errorf("unexpected ancestor event %#v", ancestor)
+	}
+	if ancestor := call(6); ancestor.Ancestor != "u_base" || ancestor.IsEvent || ancestor.Range().Start.Column != 1 {
+		t.Errorf("unexpected ancestor function %#v", ancestor)
+	}
+	if own := call(7); !own.IsEvent || own.Method.(ast.SymbolExpr).Value != "ue_refresh" {
+		t.Errorf("unexpected event call without object %#v", own)
+	}
+	if stmt := body[8].(ast.CallStmt); stmt.Ancestor != "w_base" || stmt.Control != "cb_ok" || stmt.Event != "clicked" {
+		t.Errorf("unexpected control call statement %#v", stmt)
+	}
+}
+
+func TestEventCallAtTopLevel(t *testing.T) {
+	source := "event ue_load(1)\nevent ue_load(ls_name, 2)\nevent ue_load(long(ls_id))\n" +
+		"event ue_save(long al_id)\nevent ue_save(u_order auo_order)\nevent ue_close()\n"
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if len(program.Body) != 6 {
+		t.Fatalf("expected 6 statements, got %d", len(program.Body))
+	}
+	for i, stmt := range program.Body {
+		switch stmt.(type) {
+		case ast.ExprStmt:
+			if i >= 3 {
+				t.Errorf("expected statement %d to be a declaration, got %#v", i, stmt)
+			}
+		case ast.EventDecl:
+			if i < 3 {
+				t.Errorf("expected statement %d to be a call, got %#v", i, stmt)
+			}
+		default:
+			t.Errorf("unexpected statement %#v", stmt)
+		}
+	}
+}
+
+// render prints an expression fully parenthesized to make its precedence
+// visible.
+func render(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case ast.BinaryExpr:
+		return fmt.Sprintf("(%s %s %s)", render(expr.Left), expr.Operator.Value, render(expr.Right))
+	case ast.PrefixExpr:
+		return fmt.Sprintf("(%s %s)", expr.Operator.Value, render(expr.Value))
+	case ast.PostfixExpr:
+		return fmt.Sprintf("(%s %s)", render(expr.Value), expr.Operator.Value)
+	case ast.GroupingExpr:
+		return render(expr.Value)
+	case ast.SymbolExpr:
+		return expr.Value
+	case ast.NumberExpr:
+		return fmt.Sprint(expr.Value)
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := map[string]string{
+		"a or b and c":         "(a or (b and c))",
+		"not a = b and c":      "((not (a = b)) and c)",
+		"a and not b or c":     "((a and (not b)) or c)",
+		"a <> b + c * d ^ 2":   "(a <> (b + (c * (d ^ 2))))",
+		"-a ^ 2":               "((- a) ^ 2)",
+		"a * -b + c":           "((a * (- b)) + c)",
+		"a - b - c":            "((a - b) - c)",
+		"ls_a + ls_b >= ls_c":  "((ls_a + ls_b) >= ls_c)",
+		"li_count++":           "(li_count ++)",
+		"not (a or b) and c--": "((not (a or b)) and (c --))",
+	}
+	for source, expected := range tests {
+		program, diagnostics := parseWithDiagnostics(source)
+		if len(diagnostics) != 0 {
+			t.Errorf("%s: unexpected diagnostics %v", source, diagnostics)
+			continue
+		}
+		if actual := render(program.Body[0].(ast.ExprStmt).Expr); actual != expected {
+			t.Errorf("%s: expected %s, got %s", source, expected, actual)
+		}
+	}
+}
+
+func TestAssignmentVersusEquality(t *testing.T) {
+	source := `ll_row = this.getrow()
+lb_same = ls_a = ls_b
+dw_1.object.data[1, 2] = "x"
+li_count += 1
+if ll_row = 0 then ll_row = 1
+`
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	row := program.Body[0].(ast.AssignStmt)
+	if row.Target.(ast.SymbolExpr).Value != "ll_row" || row.Range().End.Column != 23 {
+		t.Errorf("unexpected assignment %#v", row)
+	}
+	if same := program.Body[1].(ast.AssignStmt); render(same.Value) != "(ls_a = ls_b)" {
+		t.Errorf("expected the second '=' to compare, got %s", render(same.Value))
+	}
+	if _, ok := program.Body[2].(ast.AssignStmt).Target.(ast.IndexExpr); !ok {
+		t.Errorf("expected an indexed assignment target, got %#v", program.Body[2])
+	}
+	if count := program.Body[3].(ast.AssignStmt); count.Operator.Kind != lexer.PLUS_EQUALS {
+		t.Errorf("unexpected compound assignment %#v", count)
+	}
+
+	stmt := program.Body[4].(ast.IfStmt)
+	if render(stmt.Condition) != "(ll_row = 0)" {
+		t.Errorf("expected the condition to compare, got %s", render(stmt.Condition))
+	}
+	if _, ok := stmt.Consequent.Body[0].(ast.AssignStmt); !ok {
+		t.Errorf("expected the statement after THEN to assign, got %#v", stmt.Consequent.Body[0])
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	_, diagnostics := parseWithDiagnostics("of_count() = 1\n")
+	if len(diagnostics) != 1 || diagnostics[0].StartColumn != 12 {
+		t.Errorf("expected a diagnostic for the call on the left-hand side, got %v", diagnostics)
+	}
+}
+
+func TestContinuedStatement(t *testing.T) {
+	source := "ls_sql = \"select id \" + &\n\t\"from orders \" + &\n\t\"where id = 1\"\nreturn ls_sql\n"
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if len(program.Body) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Body))
+	}
+	if sql := program.Body[0].(ast.AssignStmt); sql.Range().End.Line != 3 {
+		t.Errorf("expected the assignment to end on line 3, got %v", sql.Range())
+	}
+}
+
+func TestSemicolonSeparatedStatements(t *testing.T) {
+	source := "a = 1; b = 2\nfor li_i = 1 to 3; of_x(li_i); next\nchoose case a; case 1; b = 1; end choose\n"
+	program, diagnostics := parseWithDiagnostics(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	if len(program.Body) != 4 {
+		t.Fatalf("expected 4 statements, got %d", len(program.Body))
+	}
+	if loop := program.Body[2].(ast.ForStmt); len(loop.Body.Body) != 1 {
+		t.Errorf("unexpected loop body %#v", loop.Body)
+	}
+	if choose := program.Body[3].(ast.ChooseCaseStmt); len(choose.Cases) != 1 || len(choose.Cases[0].Body.Body) != 1 {
+		t.Errorf("unexpected choose case %#v", choose)
+	}
+}
+
+func TestStringLiteralKeepsRawText(t *testing.T) {
+	program, diagnostics := parseWithDiagnostics(`ls_msg = "Line 1~r~nSay ~"hi~""` + "\n")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	str := program.Body[0].(ast.AssignStmt).Value.(ast.StringExpr)
+	if str.Value != "Line 1\r\nSay \"hi\"" || str.Raw != `Line 1~r~nSay ~"hi~"` || str.Range() != span(9, 31) {
+		t.Errorf("unexpected string %#v", str)
+	}
+}